@@ -7,7 +7,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"log/slog"
 	"os"
-	"pkg/api"
+	apiv2 "pkg/api/v2"
 	"pkg/logger"
 )
 
@@ -17,17 +17,17 @@ func main() {
 	log := logger.GetLogger(ctx)
 	conn, err := grpc.NewClient("orchestrator:8081", grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Error("Failed to connect to orch_grpc server: ", err)
+		log.Error("Failed to connect to orch_grpc server:", "err", err)
 		return
 	}
 	defer func(conn *grpc.ClientConn) {
 		err := conn.Close()
 		if err != nil {
-			log.Error("Failed to close connection to orch_grpc server: ", err)
+			log.Error("Failed to close connection to orch_grpc server:", "err", err)
 		}
 	}(conn)
 
-	orchClient := api.NewOrchestratorClient(conn)
+	orchClient := apiv2.NewOrchestratorClient(conn)
 	log.Info("Starting orchestrator client")
 
 	agent := client.NewAgentClient(orchClient)
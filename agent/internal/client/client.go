@@ -4,58 +4,219 @@ import (
 	"agent/internal/demon"
 	"agent/internal/entities"
 	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"os"
-	"pkg/api"
+	apiv2 "pkg/api/v2"
 	logger2 "pkg/logger"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// decimalMode is the mode of tasks that are computed exactly
+const decimalMode = "decimal"
+
+const (
+	// pollTimeout is the longest time a GetTask request waits for a task
+	pollTimeout = 30 * time.Second
+	// pollInterval is the shortest time between GetTask requests that returned no task
+	pollInterval = 5 * time.Second
+)
+
+// reconnectDelay is the pause before the agent opens a new stream after the previous one broke
+const reconnectDelay = 5 * time.Second
+
 type AgentClient struct {
-	client api.OrchestratorClient
+	client apiv2.OrchestratorClient
+	// id identifies the agent in the registry of the orchestrator
+	id string
 }
 
-func NewAgentClient(client api.OrchestratorClient) *AgentClient {
-	return &AgentClient{client: client}
+func NewAgentClient(client apiv2.OrchestratorClient) *AgentClient {
+	return &AgentClient{client: client, id: agentId()}
+}
+
+// agentId returns AGENT_ID or the host name with the process id, so agents on the same host differ
+func agentId() string {
+	if id := os.Getenv("AGENT_ID"); id != "" {
+		return id
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
 
 // ManageTasks is a function that manages tasks
 func ManageTasks(ctx context.Context, agent *AgentClient) {
 	logger := logger2.GetLogger(ctx)
 	logger.Info("ManageTasks: Start")
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
 	computingPower, err := strconv.Atoi(os.Getenv("COMPUTING_POWER"))
 	if err != nil || computingPower <= 0 {
 		computingPower = 1
 	}
+	go keepRegistered(ctx, agent, computingPower)
+
+	for {
+		err = workStream(ctx, agent, computingPower)
+		if ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			logger.Info("ManageTasks: orchestrator doesn't support streaming, polling tasks")
+			pollTasks(ctx, agent, computingPower)
+			return
+		}
+		logger.Error("ManageTasks: work stream error:", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// keepRegistered registers the agent and sends heartbeats until the context is done,
+// the agent registers again if the orchestrator has forgotten it
+func keepRegistered(ctx context.Context, agent *AgentClient, computingPower int) {
+	logger := logger2.GetLogger(ctx)
+	hostname, _ := os.Hostname()
+	registered := false
+	interval := reconnectDelay
+	for {
+		var err error
+		if !registered {
+			var response *apiv2.RegisterAgentResponse
+			response, err = agent.client.RegisterAgent(ctx, &apiv2.RegisterAgentRequest{
+				AgentId:        agent.id,
+				Hostname:       hostname,
+				ComputingPower: int32(computingPower),
+				Operations:     demon.Operations(),
+			})
+			if err == nil {
+				registered = true
+				interval = time.Duration(response.HeartbeatIntervalMs) * time.Millisecond
+				logger.Info("keepRegistered: agent registered", "Id", agent.id)
+			}
+		} else {
+			_, err = agent.client.Heartbeat(ctx, &apiv2.HeartbeatRequest{AgentId: agent.id})
+			if status.Code(err) == codes.NotFound {
+				registered = false
+				continue
+			}
+		}
+		if status.Code(err) == codes.Unimplemented {
+			logger.Info("keepRegistered: orchestrator doesn't support agent registration")
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Error("keepRegistered: error:", "err", err)
+		}
+		if interval <= 0 {
+			interval = reconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// workStream receives tasks pushed by the orchestrator and sends their results back on the same stream,
+// the agent grants a credit for every free worker so it never gets more tasks than it can compute
+func workStream(ctx context.Context, agent *AgentClient, computingPower int) error {
+	logger := logger2.GetLogger(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := agent.client.Work(ctx)
+	if err != nil {
+		return err
+	}
+	// gRPC streams don't allow concurrent sends, workers report results one by one
+	var sendMutex sync.Mutex
+	send := func(message *apiv2.AgentMessage) error {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		return stream.Send(message)
+	}
+	if err = send(&apiv2.AgentMessage{AgentId: agent.id, Credits: int32(computingPower)}); err != nil {
+		return err
+	}
+
+	taskChan := make(chan entities.AgentResponse, computingPower)
+	defer close(taskChan)
+	for i := 0; i < computingPower; i++ {
+		go func() {
+			for task := range taskChan {
+				message := computeTask(task, ctx)
+				message.Credits = 1
+				if err := send(message); err != nil {
+					logger.Error("workStream: send result error:", "err", err)
+				}
+			}
+		}()
+	}
+
+	for {
+		assignment, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		task := newAgentResponse(assignment.Task)
+		logger.Info("workStream: Task accepted:", "Id", task.TaskId)
+		taskChan <- task
+	}
+}
+
+// pollTasks requests tasks for orchestrators without the Work stream, every request waits for a task
+// up to pollTimeout. Orchestrators without long polling respond at once, they are polled once in pollInterval
+func pollTasks(ctx context.Context, agent *AgentClient, computingPower int) {
+	logger := logger2.GetLogger(ctx)
 	taskChan := make(chan entities.AgentResponse, 1)
 
 	for i := 0; i < computingPower; i++ {
 		go worker(agent, taskChan, ctx)
 	}
 
-	for range ticker.C {
-		taskAccepted, err := agent.client.GetTask(ctx, &api.GetTaskRequest{})
+	for ctx.Err() == nil {
+		start := time.Now()
+		requestCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		taskAccepted, err := agent.client.GetTask(requestCtx, &apiv2.GetTaskRequest{
+			AgentId:    agent.id,
+			Operations: demon.Operations(),
+			Wait:       true,
+		})
+		cancel()
 		if err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollInterval - time.Since(start)):
+			}
 			continue
 		}
 
-		task := entities.AgentResponse{
-			Id:            int(taskAccepted.Id),
-			Arg1:          float64(taskAccepted.Arg1),
-			Arg2:          float64(taskAccepted.Arg2),
-			Operation:     taskAccepted.Operation,
-			OperationTime: int(taskAccepted.OperationTime),
-		}
-
-		logger.Info("ManageTasks: Task accepted:", "Id", task.Id)
+		task := newAgentResponse(taskAccepted)
+		logger.Info("ManageTasks: Task accepted:", "Id", task.TaskId)
 
 		taskChan <- task
 		logger.Info("ManageTasks: Task received")
 	}
 }
 
+// newAgentResponse converts the task received from the orchestrator
+func newAgentResponse(taskAccepted *apiv2.GetTaskResponse) entities.AgentResponse {
+	return entities.AgentResponse{
+		Id:            int(taskAccepted.Id),
+		TaskId:        taskAccepted.TaskId,
+		Args:          taskAccepted.Args,
+		Operation:     taskAccepted.Operation,
+		OperationTime: int(taskAccepted.OperationTime),
+		Mode:          taskAccepted.Mode,
+		DecimalArgs:   taskAccepted.DecimalArgs,
+	}
+}
+
 // worker is a function that processes tasks
 func worker(agent *AgentClient, taskChan <-chan entities.AgentResponse, ctx context.Context) {
 	for task := range taskChan {
@@ -63,23 +224,64 @@ func worker(agent *AgentClient, taskChan <-chan entities.AgentResponse, ctx cont
 	}
 }
 
-// solveTask is a function that solves the task
-func solveTask(agent *AgentClient, task entities.AgentResponse, ctx context.Context) {
+// computeTask calculates the task and returns the message with its result or error
+func computeTask(task entities.AgentResponse, ctx context.Context) *apiv2.AgentMessage {
 	logger := logger2.GetLogger(ctx)
-	result, err := demon.CalculateExpression(task.Arg1, task.Arg2, task.Operation, task.OperationTime)
+	if task.Mode == decimalMode {
+		return computeDecimalTask(task, ctx)
+	}
+	result, err := demon.CalculateExpression(task.Operation, task.Args, task.OperationTime)
 	if err != nil {
 		logger.Error("solveTask: calculating expression error:", "err", err)
+		return &apiv2.AgentMessage{Failure: &apiv2.FailTaskRequest{
+			Id:     int32(task.Id),
+			TaskId: task.TaskId,
+			Error:  err.Error(),
+		}}
+	}
+	logger.Info("solveTask", "Id:", task.TaskId, "Result:", result)
+	return &apiv2.AgentMessage{Result: &apiv2.PostTaskRequest{
+		Id:     int32(task.Id),
+		TaskId: task.TaskId,
+		Result: result,
+	}}
+}
+
+// computeDecimalTask calculates the task exactly and returns the message with its result or error
+func computeDecimalTask(task entities.AgentResponse, ctx context.Context) *apiv2.AgentMessage {
+	logger := logger2.GetLogger(ctx)
+	result, err := demon.CalculateDecimal(task.Operation, task.DecimalArgs, task.OperationTime)
+	if err != nil {
+		logger.Error("solveTask: calculating expression error:", "err", err)
+		return &apiv2.AgentMessage{Failure: &apiv2.FailTaskRequest{
+			Id:     int32(task.Id),
+			TaskId: task.TaskId,
+			Error:  err.Error(),
+		}}
+	}
+	logger.Info("solveTask", "Id:", task.TaskId, "Result:", result)
+	return &apiv2.AgentMessage{Result: &apiv2.PostTaskRequest{
+		Id:            int32(task.Id),
+		TaskId:        task.TaskId,
+		DecimalResult: result,
+	}}
+}
+
+// solveTask is a function that solves the task
+func solveTask(agent *AgentClient, task entities.AgentResponse, ctx context.Context) {
+	logger := logger2.GetLogger(ctx)
+	message := computeTask(task, ctx)
+	if message.Failure != nil {
+		if _, err := agent.client.FailTask(ctx, message.Failure); err != nil {
+			logger.Error("solveTask: fail task error:", "err", err)
+		}
 		return
 	}
 
-	_, err = agent.client.PostTask(ctx, &api.PostTaskRequest{
-		Id:     int32(task.Id),
-		Result: float32(result),
-	})
+	_, err := agent.client.PostTask(ctx, message.Result)
 	if err != nil {
 		logger.Error("solveTask: post task error:", "err", err)
 		return
 	}
 	logger.Info("solveTask: Task solved")
-	logger.Info("solveTask", "Id:", task.Id, "Result:", result)
 }
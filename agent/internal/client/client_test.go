@@ -8,25 +8,34 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
 	"log/slog"
 	"os"
-	"pkg/api"
+	apiv2 "pkg/api/v2"
 	logger2 "pkg/logger"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 // mockOrchestratorClient struct for testing client.go
 type mockOrchestratorClient struct {
-	getTaskFunc    func(ctx context.Context, in *api.GetTaskRequest, opts ...grpc.CallOption) (*api.GetTaskResponse, error)
-	postTaskCalled bool
-	postTaskID     int32
-	postTaskResult float32
-	postTaskError  error
+	getTaskFunc   func(ctx context.Context, in *apiv2.GetTaskRequest, opts ...grpc.CallOption) (*apiv2.GetTaskResponse, error)
+	workStream    *mockWorkStream
+	postTaskError error
+	// posted and failed are the requests of PostTask and FailTask, workers call them from their goroutines
+	posted []*apiv2.PostTaskRequest
+	failed []*apiv2.FailTaskRequest
+	mutex  sync.Mutex
+	// registered receives registrations, orchestrators without registration respond with Unimplemented
+	registered chan *apiv2.RegisterAgentRequest
+	// heartbeatFunc imitates heartbeats, they succeed by default
+	heartbeatFunc func(in *apiv2.HeartbeatRequest) error
 }
 
 // GetTask imitates server handler
-func (m *mockOrchestratorClient) GetTask(ctx context.Context, in *api.GetTaskRequest, opts ...grpc.CallOption) (*api.GetTaskResponse, error) {
+func (m *mockOrchestratorClient) GetTask(ctx context.Context, in *apiv2.GetTaskRequest, opts ...grpc.CallOption) (*apiv2.GetTaskResponse, error) {
 	if m.getTaskFunc != nil {
 		return m.getTaskFunc(ctx, in, opts...)
 	}
@@ -34,11 +43,84 @@ func (m *mockOrchestratorClient) GetTask(ctx context.Context, in *api.GetTaskReq
 }
 
 // PostTask imitates server handler
-func (m *mockOrchestratorClient) PostTask(ctx context.Context, in *api.PostTaskRequest, opts ...grpc.CallOption) (*api.PostTaskResponse, error) {
-	m.postTaskCalled = true
-	m.postTaskID = in.Id
-	m.postTaskResult = in.Result
-	return &api.PostTaskResponse{}, m.postTaskError
+func (m *mockOrchestratorClient) PostTask(ctx context.Context, in *apiv2.PostTaskRequest, opts ...grpc.CallOption) (*apiv2.PostTaskResponse, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.posted = append(m.posted, in)
+	return &apiv2.PostTaskResponse{}, m.postTaskError
+}
+
+// lastPost returns the last request of PostTask, nil if it wasn't called
+func (m *mockOrchestratorClient) lastPost() *apiv2.PostTaskRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.posted) == 0 {
+		return nil
+	}
+	return m.posted[len(m.posted)-1]
+}
+
+// FailTask imitates server handler
+func (m *mockOrchestratorClient) FailTask(ctx context.Context, in *apiv2.FailTaskRequest, opts ...grpc.CallOption) (*apiv2.FailTaskResponse, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failed = append(m.failed, in)
+	return &apiv2.FailTaskResponse{}, nil
+}
+
+// lastFailure returns the last request of FailTask, nil if it wasn't called
+func (m *mockOrchestratorClient) lastFailure() *apiv2.FailTaskRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.failed) == 0 {
+		return nil
+	}
+	return m.failed[len(m.failed)-1]
+}
+
+// Work imitates server handler, orchestrators without a work stream respond with Unimplemented
+func (m *mockOrchestratorClient) Work(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[apiv2.AgentMessage, apiv2.TaskAssignment], error) {
+	if m.workStream == nil {
+		return nil, status.Error(codes.Unimplemented, "method Work not implemented")
+	}
+	return m.workStream, nil
+}
+
+// RegisterAgent imitates server handler
+func (m *mockOrchestratorClient) RegisterAgent(ctx context.Context, in *apiv2.RegisterAgentRequest, opts ...grpc.CallOption) (*apiv2.RegisterAgentResponse, error) {
+	if m.registered == nil {
+		return nil, status.Error(codes.Unimplemented, "method RegisterAgent not implemented")
+	}
+	m.registered <- in
+	return &apiv2.RegisterAgentResponse{HeartbeatIntervalMs: 10}, nil
+}
+
+// Heartbeat imitates server handler
+func (m *mockOrchestratorClient) Heartbeat(ctx context.Context, in *apiv2.HeartbeatRequest, opts ...grpc.CallOption) (*apiv2.HeartbeatResponse, error) {
+	if m.heartbeatFunc != nil {
+		return nil, m.heartbeatFunc(in)
+	}
+	return &apiv2.HeartbeatResponse{}, nil
+}
+
+// mockWorkStream imitates the Work stream of the orchestrator
+type mockWorkStream struct {
+	grpc.ClientStream
+	assignments chan *apiv2.TaskAssignment
+	sent        chan *apiv2.AgentMessage
+}
+
+func (m *mockWorkStream) Send(message *apiv2.AgentMessage) error {
+	m.sent <- message
+	return nil
+}
+
+func (m *mockWorkStream) Recv() (*apiv2.TaskAssignment, error) {
+	assignment, ok := <-m.assignments
+	if !ok {
+		return nil, io.EOF
+	}
+	return assignment, nil
 }
 
 // TestSolveTask_Success tests the happy path where calculation and posting succeed
@@ -49,17 +131,59 @@ func TestSolveTask_Success(t *testing.T) {
 
 	task := entities.AgentResponse{
 		Id:            1,
-		Arg1:          2.0,
-		Arg2:          3.0,
+		TaskId:        "1.1",
+		Args:          []float64{2.0, 3.0},
 		Operation:     "+",
 		OperationTime: 100,
 	}
 
 	solveTask(agent, task, ctx)
 
-	assert.True(t, mockClient.postTaskCalled)
-	assert.Equal(t, int32(1), mockClient.postTaskID)
-	assert.Equal(t, float32(5.0), mockClient.postTaskResult)
+	posted := mockClient.lastPost()
+	assert.NotNil(t, posted)
+	assert.Equal(t, int32(1), posted.Id)
+	assert.Equal(t, "1.1", posted.TaskId)
+	assert.Equal(t, 5.0, posted.Result)
+}
+
+// TestSolveTask_KeepsPrecision tests that the result is posted without rounding to float
+func TestSolveTask_KeepsPrecision(t *testing.T) {
+	mockClient := &mockOrchestratorClient{}
+	agent := NewAgentClient(mockClient)
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	task := entities.AgentResponse{
+		Id:            1,
+		TaskId:        "1.1",
+		Args:          []float64{123456789.25, 0.5},
+		Operation:     "+",
+		OperationTime: 0,
+	}
+
+	solveTask(agent, task, ctx)
+
+	assert.Equal(t, 123456789.75, mockClient.lastPost().Result)
+}
+
+// TestSolveTask_Decimal tests that decimal tasks are computed exactly and posted as fractions
+func TestSolveTask_Decimal(t *testing.T) {
+	mockClient := &mockOrchestratorClient{}
+	agent := NewAgentClient(mockClient)
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	task := entities.AgentResponse{
+		Id:          1,
+		TaskId:      "1.1",
+		DecimalArgs: []string{"1/10", "1/5"},
+		Operation:   "+",
+		Mode:        "decimal",
+	}
+
+	solveTask(agent, task, ctx)
+
+	posted := mockClient.lastPost()
+	assert.NotNil(t, posted)
+	assert.Equal(t, "3/10", posted.DecimalResult)
 }
 
 // TestSolveTask_PostTaskFails tests when PostTask fails
@@ -70,15 +194,38 @@ func TestSolveTask_PostTaskFails(t *testing.T) {
 
 	task := entities.AgentResponse{
 		Id:            1,
-		Arg1:          2.0,
-		Arg2:          3.0,
+		TaskId:        "1.1",
+		Args:          []float64{2.0, 3.0},
 		Operation:     "+",
 		OperationTime: 100,
 	}
 
 	solveTask(agent, task, ctx)
 
-	assert.True(t, mockClient.postTaskCalled)
+	assert.NotNil(t, mockClient.lastPost())
+}
+
+// TestSolveTask_CalculationFails tests that a calculation error is reported with FailTask
+func TestSolveTask_CalculationFails(t *testing.T) {
+	mockClient := &mockOrchestratorClient{}
+	agent := NewAgentClient(mockClient)
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	task := entities.AgentResponse{
+		Id:            1,
+		TaskId:        "1.2",
+		Args:          []float64{2.0, 3.0},
+		Operation:     "&",
+		OperationTime: 100,
+	}
+
+	solveTask(agent, task, ctx)
+
+	assert.Nil(t, mockClient.lastPost())
+	failure := mockClient.lastFailure()
+	assert.NotNil(t, failure)
+	assert.Equal(t, "1.2", failure.TaskId)
+	assert.Equal(t, "wrong operator", failure.Error)
 }
 
 // TestWorker tests that the worker processes a task from the channel
@@ -93,29 +240,32 @@ func TestWorker(t *testing.T) {
 
 	task := entities.AgentResponse{
 		Id:            1,
-		Arg1:          2.0,
-		Arg2:          3.0,
+		TaskId:        "1.1",
+		Args:          []float64{2.0, 3.0},
 		Operation:     "+",
 		OperationTime: 100,
 	}
 	taskChan <- task
 
-	time.Sleep(100 * time.Millisecond) // Give worker time to process
-	assert.True(t, mockClient.postTaskCalled)
-	assert.Equal(t, int32(1), mockClient.postTaskID)
-	assert.Equal(t, float32(5.0), mockClient.postTaskResult)
+	// Give worker time to process
+	assert.Eventually(t, func() bool { return mockClient.lastPost() != nil }, time.Second, 10*time.Millisecond)
+	posted := mockClient.lastPost()
+	assert.Equal(t, int32(1), posted.Id)
+	assert.Equal(t, "1.1", posted.TaskId)
+	assert.Equal(t, 5.0, posted.Result)
 }
 
 // TestManageTasks tests that ManageTasks starts workers and processes a task
 func TestManageTasks(t *testing.T) {
 	os.Setenv("COMPUTING_POWER", "1")
 
-	taskReturned := false
+	var taskReturned atomic.Bool
 	mockClient := &mockOrchestratorClient{
-		getTaskFunc: func(ctx context.Context, in *api.GetTaskRequest, opts ...grpc.CallOption) (*api.GetTaskResponse, error) {
-			if !taskReturned {
-				taskReturned = true
-				return &api.GetTaskResponse{Id: 1, Arg1: 2.0, Arg2: 3.0, Operation: "+", OperationTime: 100}, nil
+		getTaskFunc: func(ctx context.Context, in *apiv2.GetTaskRequest, opts ...grpc.CallOption) (*apiv2.GetTaskResponse, error) {
+			// the agent long polls, the orchestrator waits for a task
+			assert.True(t, in.Wait)
+			if taskReturned.CompareAndSwap(false, true) {
+				return &apiv2.GetTaskResponse{Id: 1, TaskId: "1.1", Args: []float64{2.0, 3.0}, Operation: "+", OperationTime: 100}, nil
 			}
 			return nil, status.Error(codes.NotFound, "no tasks")
 		},
@@ -135,12 +285,86 @@ func TestManageTasks(t *testing.T) {
 		case <-timeout:
 			t.Fatal("Timeout waiting for PostTask")
 		default:
-			if mockClient.postTaskCalled {
-				assert.Equal(t, int32(1), mockClient.postTaskID)
-				assert.Equal(t, float32(5.0), mockClient.postTaskResult)
+			if posted := mockClient.lastPost(); posted != nil {
+				assert.Equal(t, int32(1), posted.Id)
+				assert.Equal(t, "1.1", posted.TaskId)
+				assert.Equal(t, 5.0, posted.Result)
 				return
 			}
 			time.Sleep(100 * time.Millisecond)
 		}
 	}
 }
+
+// TestManageTasks_Stream tests that tasks pushed on the work stream are computed and every result returns a credit
+func TestManageTasks_Stream(t *testing.T) {
+	os.Setenv("COMPUTING_POWER", "2")
+
+	stream := &mockWorkStream{assignments: make(chan *apiv2.TaskAssignment), sent: make(chan *apiv2.AgentMessage, 3)}
+	agent := NewAgentClient(&mockOrchestratorClient{workStream: stream})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = logger2.WithLogger(ctx, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	go ManageTasks(ctx, agent)
+
+	first := <-stream.sent
+	assert.Equal(t, int32(2), first.Credits)
+	assert.Equal(t, agent.id, first.AgentId)
+	stream.assignments <- &apiv2.TaskAssignment{Task: &apiv2.GetTaskResponse{Id: 1, TaskId: "1.1", Args: []float64{2, 3}, Operation: "+", OperationTime: 100}}
+	stream.assignments <- &apiv2.TaskAssignment{Task: &apiv2.GetTaskResponse{Id: 1, TaskId: "1.2", Args: []float64{1}, Operation: "tan", OperationTime: 100}}
+
+	results := make(map[string]*apiv2.AgentMessage)
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-stream.sent:
+			assert.Equal(t, int32(1), message.Credits)
+			if message.Result != nil {
+				results[message.Result.TaskId] = message
+			} else {
+				results[message.Failure.TaskId] = message
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for results")
+		}
+	}
+	assert.Equal(t, 5.0, results["1.1"].Result.Result)
+	assert.Equal(t, `unknown function "tan"`, results["1.2"].Failure.Error)
+	cancel()
+	close(stream.assignments)
+}
+
+// TestKeepRegistered tests that the agent registers with its operations and registers again once the orchestrator forgets it
+func TestKeepRegistered(t *testing.T) {
+	os.Setenv("AGENT_ID", "agent-1")
+	defer os.Unsetenv("AGENT_ID")
+
+	heartbeats := make(chan string, 1)
+	mockClient := &mockOrchestratorClient{
+		registered: make(chan *apiv2.RegisterAgentRequest),
+		heartbeatFunc: func(in *apiv2.HeartbeatRequest) error {
+			heartbeats <- in.AgentId
+			return status.Error(codes.NotFound, "Agent is not registered")
+		},
+	}
+	agent := NewAgentClient(mockClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = logger2.WithLogger(ctx, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	go keepRegistered(ctx, agent, 3)
+
+	registration := <-mockClient.registered
+	assert.Equal(t, "agent-1", registration.AgentId)
+	assert.Equal(t, int32(3), registration.ComputingPower)
+	assert.Contains(t, registration.Operations, "+")
+	assert.Contains(t, registration.Operations, "sqrt")
+
+	assert.Equal(t, "agent-1", <-heartbeats)
+	select {
+	case registration = <-mockClient.registered:
+		assert.Equal(t, "agent-1", registration.AgentId)
+	case <-time.After(time.Second):
+		t.Fatal("agent didn't register again")
+	}
+}
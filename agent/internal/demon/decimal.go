@@ -0,0 +1,166 @@
+package demon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxDecimalExponent limits exponents of powers and of arguments such as 1e-3
+	maxDecimalExponent = 10000
+	// maxDecimalBits limits the numerator and the denominator of results,
+	// larger numbers take minutes and gigabytes to compute
+	maxDecimalBits = 1 << 17
+)
+
+// decimalFunctions contains functions that have exact results in the decimal mode
+var decimalFunctions = map[string]func(args []*big.Rat) *big.Rat{
+	"abs": func(args []*big.Rat) *big.Rat {
+		return new(big.Rat).Abs(args[0])
+	},
+	"min": func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return result
+	},
+	"max": func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return result
+	},
+}
+
+// CalculateDecimal calculates the operator or the function over exact arguments such as "1/3" or "0.1",
+// the result is an exact fraction
+func CalculateDecimal(operation string, args []string, operationTime int) (string, error) {
+	rats := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		rat, err := parseDecimal(arg)
+		if err != nil {
+			return "", err
+		}
+		rats[i] = rat
+	}
+	result, err := calculateDecimal(operation, rats)
+	if err != nil {
+		return "", err
+	}
+	time.Sleep(time.Duration(operationTime) * time.Millisecond)
+	return result.RatString(), nil
+}
+
+// parseDecimal parses the exact argument, its exponent is limited like in powers,
+// since the number is multiplied by 10 to the exponent
+func parseDecimal(arg string) (*big.Rat, error) {
+	if i := strings.IndexAny(arg, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(arg[i+1:])
+		if errors.Is(err, strconv.ErrRange) || err == nil && (exponent > maxDecimalExponent || exponent < -maxDecimalExponent) {
+			return nil, fmt.Errorf("exponent of %q is too large for decimal mode", arg)
+		}
+	}
+	rat, ok := new(big.Rat).SetString(arg)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", arg)
+	}
+	return rat, nil
+}
+
+// ratBits returns the size of the larger of the numerator and the denominator in bits
+func ratBits(r *big.Rat) int64 {
+	return int64(max(r.Num().BitLen(), r.Denom().BitLen()))
+}
+
+// calculateDecimal dispatches the operation without simulating its duration
+func calculateDecimal(operation string, args []*big.Rat) (*big.Rat, error) {
+	switch operation {
+	case "+", "-", "*", "/", "^", "%", "//":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("operator %s expects 2 arguments, got %d", operation, len(args))
+		}
+		a, b := args[0], args[1]
+		if operation != "^" && ratBits(a)+ratBits(b) > maxDecimalBits {
+			return nil, errors.New("result is too large for decimal mode")
+		}
+		switch operation {
+		case "+":
+			return new(big.Rat).Add(a, b), nil
+		case "-":
+			return new(big.Rat).Sub(a, b), nil
+		case "*":
+			return new(big.Rat).Mul(a, b), nil
+		case "^":
+			return power(a, b)
+		}
+		if b.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		switch operation {
+		case "/":
+			return new(big.Rat).Quo(a, b), nil
+		case "%":
+			// the remainder has the sign of the dividend like math.Mod
+			quotient := new(big.Rat).Quo(a, b)
+			truncated := new(big.Rat).SetInt(new(big.Int).Quo(quotient.Num(), quotient.Denom()))
+			return new(big.Rat).Sub(a, truncated.Mul(truncated, b)), nil
+		default:
+			quotient := new(big.Rat).Quo(a, b)
+			return new(big.Rat).SetInt(new(big.Int).Div(quotient.Num(), quotient.Denom())), nil
+		}
+	case "~":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("operator %s expects 1 argument, got %d", operation, len(args))
+		}
+		return new(big.Rat).Neg(args[0]), nil
+	}
+	f, ok := decimalFunctions[operation]
+	if !ok {
+		if _, ok = functions[operation]; ok {
+			return nil, fmt.Errorf("function %s is not supported in decimal mode", operation)
+		}
+		if operation != "" && unicode.IsLetter(rune(operation[0])) {
+			return nil, fmt.Errorf("unknown function %q", operation)
+		}
+		return nil, errors.New("wrong operator")
+	}
+	if arity := functions[operation]; len(args) < arity.min || (arity.max >= 0 && len(args) > arity.max) {
+		return nil, fmt.Errorf("function %s can't be called with %d arguments", operation, len(args))
+	}
+	return f(args), nil
+}
+
+// power raises a to the integer power b
+func power(a, b *big.Rat) (*big.Rat, error) {
+	if !b.IsInt() {
+		return nil, errors.New("decimal mode supports only integer exponents")
+	}
+	if new(big.Rat).Abs(b).Cmp(big.NewRat(maxDecimalExponent, 1)) > 0 {
+		return nil, errors.New("exponent is too large for decimal mode")
+	}
+	if a.Sign() == 0 && b.Sign() < 0 {
+		return nil, errors.New("division by zero")
+	}
+	exponent := new(big.Int).Abs(b.Num())
+	// the power has at most |b| times as many bits as a
+	if ratBits(a)*exponent.Int64() > maxDecimalBits {
+		return nil, errors.New("power is too large for decimal mode")
+	}
+	num := new(big.Int).Exp(a.Num(), exponent, nil)
+	denom := new(big.Int).Exp(a.Denom(), exponent, nil)
+	if b.Sign() < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
@@ -0,0 +1,56 @@
+package demon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalculateDecimal(t *testing.T) {
+	tests := []struct {
+		args      []string
+		operation string
+		want      string
+		wantErr   bool
+	}{
+		{[]string{"1/10", "1/5"}, "+", "3/10", false},
+		{[]string{"0.3", "0.1"}, "-", "1/5", false},
+		{[]string{"1/3", "3"}, "*", "1", false},
+		{[]string{"1", "3"}, "/", "1/3", false},
+		{[]string{"2/3", "-2"}, "^", "9/4", false},
+		{[]string{"-7/2", "2"}, "%", "-3/2", false},
+		{[]string{"-7/2", "2"}, "//", "-2", false},
+		{[]string{"7/2", "2"}, "//", "1", false},
+		{[]string{"1/10"}, "~", "-1/10", false},
+		{[]string{"-1/10"}, "abs", "1/10", false},
+		{[]string{"1/3", "0.3", "1/2"}, "min", "3/10", false},
+		{[]string{"1/3", "0.3", "1/2"}, "max", "1/2", false},
+		{[]string{"1", "0"}, "/", "", true},
+		{[]string{"1", "0"}, "%", "", true},
+		{[]string{"0", "-1"}, "^", "", true},
+		{[]string{"2", "1/2"}, "^", "", true},
+		{[]string{"2", "100000"}, "^", "", true},
+		{[]string{"1/100000", "10000"}, "^", "", true},
+		{[]string{"10000000000", "-10000"}, "^", "", true},
+		{[]string{strings.Repeat("9", 30000), strings.Repeat("9", 30000)}, "*", "", true},
+		{[]string{"1e-100000000", "1"}, "+", "", true},
+		{[]string{"1e10", "2"}, "+", "10000000002", false},
+		{[]string{"4"}, "sqrt", "", true},
+		{[]string{"1", "2"}, "abs", "", true},
+		{[]string{"1", "2"}, "&", "", true},
+		{[]string{"1"}, "tan", "", true},
+		{[]string{"one", "2"}, "+", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			got, err := CalculateDecimal(tt.operation, tt.args, 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CalculateDecimal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("CalculateDecimal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
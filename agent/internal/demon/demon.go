@@ -2,25 +2,128 @@ package demon
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"sort"
 	"time"
+	"unicode"
 )
 
-// CalculateExpression calculates the expression
-func CalculateExpression(a, b float64, operation string, operationTime int) (float64, error) {
+// function is a built-in function, max < 0 means unlimited number of arguments
+type function struct {
+	min, max int
+	apply    func(args []float64) (float64, error)
+}
+
+// unary wraps a math function of one argument
+func unary(f func(float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return f(args[0]), nil
+	}
+}
+
+// functions contains built-in functions that can be called in expressions
+var functions = map[string]function{
+	"sqrt": {1, 1, func(args []float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, errors.New("square root of negative number")
+		}
+		return math.Sqrt(args[0]), nil
+	}},
+	"abs": {1, 1, unary(math.Abs)},
+	"log": {1, 1, func(args []float64) (float64, error) {
+		if args[0] <= 0 {
+			return 0, errors.New("logarithm of non-positive number")
+		}
+		return math.Log(args[0]), nil
+	}},
+	"sin": {1, 1, unary(math.Sin)},
+	"cos": {1, 1, unary(math.Cos)},
+	"min": {1, -1, func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"max": {1, -1, func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+}
+
+// operators contains the operators the agent computes, ~ is the unary minus
+var operators = []string{"+", "-", "*", "/", "^", "%", "//", "~"}
+
+// Operations returns the operators and the functions the agent can compute
+func Operations() []string {
+	operations := append([]string{}, operators...)
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(operations, names...)
+}
+
+// CalculateExpression calculates the operator or the function over the arguments
+func CalculateExpression(operation string, args []float64, operationTime int) (float64, error) {
+	result, err := calculate(operation, args)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) {
+		return 0, errors.New("result is not a number")
+	}
+	if math.IsInf(result, 0) {
+		return 0, errors.New("overflow")
+	}
+	time.Sleep(time.Duration(operationTime) * time.Millisecond)
+	return result, nil
+}
+
+// calculate dispatches the operation without simulating its duration
+func calculate(operation string, args []float64) (float64, error) {
 	switch operation {
-	case "+":
-		time.Sleep(time.Duration(operationTime) * time.Millisecond)
-		return a + b, nil
-	case "-":
-		time.Sleep(time.Duration(operationTime) * time.Millisecond)
-		return a - b, nil
-	case "*":
-		time.Sleep(time.Duration(operationTime) * time.Millisecond)
-		return a * b, nil
-	case "/":
-		time.Sleep(time.Duration(operationTime) * time.Millisecond)
-		return a / b, nil
-	default:
+	case "+", "-", "*", "/", "^", "%", "//":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("operator %s expects 2 arguments, got %d", operation, len(args))
+		}
+		a, b := args[0], args[1]
+		switch operation {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/":
+			return a / b, nil
+		case "^":
+			return math.Pow(a, b), nil
+		case "%":
+			return math.Mod(a, b), nil
+		default:
+			return math.Floor(a / b), nil
+		}
+	case "~":
+		if len(args) != 1 {
+			return 0, fmt.Errorf("operator %s expects 1 argument, got %d", operation, len(args))
+		}
+		return -args[0], nil
+	}
+	f, ok := functions[operation]
+	if !ok {
+		if operation != "" && unicode.IsLetter(rune(operation[0])) {
+			return 0, fmt.Errorf("unknown function %q", operation)
+		}
 		return 0, errors.New("wrong operator")
 	}
+	if len(args) < f.min || (f.max >= 0 && len(args) > f.max) {
+		return 0, fmt.Errorf("function %s can't be called with %d arguments", operation, len(args))
+	}
+	return f.apply(args)
 }
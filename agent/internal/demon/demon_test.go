@@ -1,29 +1,48 @@
 package demon
 
 import (
+	"math"
 	"testing"
 	"time"
 )
 
 func TestCalculateExpression(t *testing.T) {
 	tests := []struct {
-		a             float64
-		b             float64
+		args          []float64
 		operation     string
 		operationTime int
 		want          float64
 		wantErr       bool
 	}{
-		{1, 2, "+", 100, 3, false},
-		{5, 3, "-", 100, 2, false},
-		{2, 3, "*", 100, 6, false},
-		{6, 2, "/", 100, 3, false},
+		{[]float64{1, 2}, "+", 100, 3, false},
+		{[]float64{5, 3}, "-", 100, 2, false},
+		{[]float64{2, 3}, "*", 100, 6, false},
+		{[]float64{6, 2}, "/", 100, 3, false},
+		{[]float64{2, 10}, "^", 100, 1024, false},
+		{[]float64{7, 4}, "%", 100, 3, false},
+		{[]float64{-7, 2}, "//", 100, -4, false},
+		{[]float64{3}, "~", 100, -3, false},
+		{[]float64{16}, "sqrt", 100, 4, false},
+		{[]float64{-2.5}, "abs", 100, 2.5, false},
+		{[]float64{math.E}, "log", 100, 1, false},
+		{[]float64{0}, "sin", 100, 0, false},
+		{[]float64{0}, "cos", 100, 1, false},
+		{[]float64{3, 7, 2}, "min", 100, 2, false},
+		{[]float64{3, 7, 2}, "max", 100, 7, false},
+		{[]float64{1, 2}, "&", 0, 0, true},
+		{[]float64{1}, "tan", 0, 0, true},
+		{[]float64{1, 2}, "sqrt", 0, 0, true},
+		{[]float64{-1}, "sqrt", 0, 0, true},
+		{[]float64{0}, "log", 0, 0, true},
+		{[]float64{1}, "+", 0, 0, true},
+		{[]float64{1e308, 10}, "*", 0, 0, true},
+		{[]float64{-8, 0.5}, "^", 0, 0, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.operation, func(t *testing.T) {
 			start := time.Now()
-			got, err := CalculateExpression(tt.a, tt.b, tt.operation, tt.operationTime)
+			got, err := CalculateExpression(tt.operation, tt.args, tt.operationTime)
 			duration := time.Since(start)
 
 			if (err != nil) != tt.wantErr {
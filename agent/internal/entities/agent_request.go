@@ -2,5 +2,6 @@ package entities
 
 type AgentRequest struct {
 	Id     int     `json:"id,omitempty"`
+	TaskId string  `json:"task_id,omitempty"`
 	Result float64 `json:"result,omitempty"`
 }
@@ -1,9 +1,12 @@
 package entities
 
 type AgentResponse struct {
-	Id            int     `json:"id,omitempty"`
-	Arg1          float64 `json:"arg1,omitempty"`
-	Arg2          float64 `json:"arg2,omitempty"`
-	Operation     string  `json:"operation,omitempty"`
-	OperationTime int     `json:"operation_time,omitempty"`
+	Id            int       `json:"id,omitempty"`
+	TaskId        string    `json:"task_id,omitempty"`
+	Args          []float64 `json:"args,omitempty"`
+	Operation     string    `json:"operation,omitempty"`
+	OperationTime int       `json:"operation_time,omitempty"`
+	// Mode is "decimal" if the task is computed exactly, its arguments are DecimalArgs then
+	Mode        string   `json:"mode,omitempty"`
+	DecimalArgs []string `json:"decimal_args,omitempty"`
 }
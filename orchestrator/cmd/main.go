@@ -2,76 +2,69 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"log/slog"
 	"net"
 	"orchestrator/internal/grpc_server"
 	"orchestrator/internal/server"
+	"orchestrator/internal/storage"
 	"os"
 	"pkg/api"
+	apiv2 "pkg/api/v2"
 	"pkg/logger"
 	"sync"
+	"time"
 )
 
-func createTables(ctx context.Context, db *sql.DB) error {
-	const (
-		usersTable = "CREATE TABLE IF NOT EXISTS users(id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT UNIQUE NOT NULL, password TEXT NOT NULL);"
-
-		expressionsTable = "CREATE TABLE IF NOT EXISTS expressions(id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, expression TEXT NOT NULL, result REAL, status TEXT NOT NULL);"
-	)
-
-	if _, err := db.ExecContext(ctx, usersTable); err != nil {
-		return err
-	}
-
-	if _, err := db.ExecContext(ctx, expressionsTable); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func main() {
 	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	ctx := logger.WithLogger(context.Background(), serverLogger)
 	log := logger.GetLogger(ctx)
 
-	db, err := sql.Open("sqlite3", "store.db")
-	if err != nil {
-		log.Error("error opening sqlite3 db: ", err)
-		return
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		dsn = "sqlite://store.db"
 	}
-	defer func(db *sql.DB) {
-		err := db.Close()
-		if err != nil {
-			log.Error("error closing sqlite3 db: ", err)
-			return
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(ctx, dsn, os.Args[2:], os.Stdout); err != nil {
+			log.Error("error migrating db:", "err", err)
+			os.Exit(1)
 		}
-	}(db)
+		return
+	}
 
-	err = db.PingContext(ctx)
+	keys, err := server.LoadKeys(ctx)
 	if err != nil {
-		log.Error("error pinging sqlite3 db: ", err)
+		log.Error("error loading jwt keys:", "err", err)
 		return
 	}
 
-	if err = createTables(ctx, db); err != nil {
-		log.Error("error creating tables: ", err)
+	repo, err := storage.Open(ctx, dsn)
+	if err != nil {
+		log.Error("error opening db:", "err", err)
 		return
 	}
+	defer func(repo storage.Repository) {
+		err := repo.Close()
+		if err != nil {
+			log.Error("error closing db:", "err", err)
+			return
+		}
+	}(repo)
 
 	log.Info("DB created")
 
+	go grpc_server.WatchLeases(ctx, time.Second)
+	go grpc_server.WatchAgents(ctx, time.Second)
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err = server.StartServer(ctx, db)
+		err = server.StartServer(ctx, repo, keys)
 		if err != nil {
-			log.Error("error starting server: ", err)
+			log.Error("error starting server:", "err", err)
 			return
 		}
 		log.Info("Server started")
@@ -85,9 +78,10 @@ func main() {
 			log.Error("error starting grpc server:", "err", err)
 		}
 		log.Info("starting grpc server:", "port", lis.Addr().(*net.TCPAddr).Port)
-		srv := grpc_server.New()
 		newServer := grpc.NewServer()
-		api.RegisterOrchestratorServer(newServer, srv)
+		// agents that still send float use the first version of the protocol during the rollout
+		api.RegisterOrchestratorServer(newServer, grpc_server.New())
+		apiv2.RegisterOrchestratorServer(newServer, grpc_server.NewV2())
 		reflection.Register(newServer)
 		if err := newServer.Serve(lis); err != nil {
 			log.Error("error starting grpc server:", "err", err)
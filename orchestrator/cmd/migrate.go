@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"orchestrator/internal/storage"
+	"time"
+)
+
+// migrate runs the migrate subcommand: up applies the pending migrations, down rolls back the last one
+// and status lists the migrations
+func migrate(ctx context.Context, dsn string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: orchestrator migrate up|down|status")
+	}
+	migrator, err := storage.OpenMigrator(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			_, _ = fmt.Fprintf(out, "applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			_, _ = fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if migration == nil {
+			_, _ = fmt.Fprintln(out, "no applied migrations")
+			return nil
+		}
+		_, _ = fmt.Fprintf(out, "rolled back %d %s\n", migration.Version, migration.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if !status.AppliedAt.IsZero() {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(out, "%d %s: %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+}
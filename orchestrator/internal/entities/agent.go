@@ -0,0 +1,117 @@
+package entities
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Agent is a registered agent as it is shown to administrators
+type Agent struct {
+	Id             string    `json:"id"`
+	Hostname       string    `json:"hostname"`
+	ComputingPower int       `json:"computing_power"`
+	Operations     []string  `json:"operations"`
+	LastSeen       time.Time `json:"last_seen"`
+	// InFlight is the number of tasks handed out to the agent whose results are not posted yet
+	InFlight int `json:"in_flight"`
+}
+
+// AgentRegistry contains the agents that send heartbeats and the tasks handed out to them
+type AgentRegistry struct {
+	agents map[string]Agent
+	// tasks contains ids of the agents by ids of the tasks handed out to them
+	tasks map[string]string
+	mutex sync.Mutex
+}
+
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{agents: make(map[string]Agent), tasks: make(map[string]string)}
+}
+
+// Register adds the agent or updates it if it registers again, the tasks handed out to it are kept
+func (r *AgentRegistry) Register(agent Agent, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	agent.LastSeen = now
+	agent.InFlight = r.agents[agent.Id].InFlight
+	r.agents[agent.Id] = agent
+}
+
+// Heartbeat marks the agent as alive, false is returned if the agent is not registered
+func (r *AgentRegistry) Heartbeat(id string, now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	agent, ok := r.agents[id]
+	if !ok {
+		return false
+	}
+	agent.LastSeen = now
+	r.agents[id] = agent
+	return true
+}
+
+// Get returns the registered agent by id
+func (r *AgentRegistry) Get(id string) (Agent, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	agent, ok := r.agents[id]
+	return agent, ok
+}
+
+// Assign records that the task is handed out to the agent
+func (r *AgentRegistry) Assign(agentId string, taskId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if agent, ok := r.agents[agentId]; ok {
+		agent.InFlight++
+		r.agents[agentId] = agent
+		r.tasks[taskId] = agentId
+	}
+}
+
+// Release forgets the task once its result is posted or it is returned to the queue
+func (r *AgentRegistry) Release(taskId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	agentId, ok := r.tasks[taskId]
+	if !ok {
+		return
+	}
+	delete(r.tasks, taskId)
+	if agent, ok := r.agents[agentId]; ok && agent.InFlight > 0 {
+		agent.InFlight--
+		r.agents[agentId] = agent
+	}
+}
+
+// Expire removes the agents last seen before the deadline and returns their ids
+func (r *AgentRegistry) Expire(deadline time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var expired []string
+	for id, agent := range r.agents {
+		if agent.LastSeen.Before(deadline) {
+			expired = append(expired, id)
+			delete(r.agents, id)
+		}
+	}
+	for taskId, agentId := range r.tasks {
+		if _, ok := r.agents[agentId]; !ok {
+			delete(r.tasks, taskId)
+		}
+	}
+	return expired
+}
+
+// List returns the registered agents sorted by id
+func (r *AgentRegistry) List() []Agent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	agents := make([]Agent, 0, len(r.agents))
+	for _, agent := range r.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Id < agents[j].Id })
+	return agents
+}
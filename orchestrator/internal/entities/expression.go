@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// Expression is the expression accepted for evaluation
+type Expression struct {
+	Id         int
+	UserId     int
+	Expression string
+	// Mode is ModeFloat or ModeDecimal
+	Mode string
+	// Priority orders the expressions of the user, expressions of higher priority are computed first
+	Priority  int
+	CreatedAt time.Time
+	// Owner is the id of the orchestrator replica evaluating the expression
+	Owner string
+}
@@ -6,9 +6,18 @@ import (
 )
 
 var (
-	Wg          = &sync.WaitGroup{}
-	ParserMutex = &sync.Mutex{}
-	ParsersTree = pkg.NewRBTree()
-	Tasks       = &pkg.Queue{}
+	Wg = &sync.WaitGroup{}
+	// Tasks contains the tasks waiting for agents, users take turns getting their tasks
+	Tasks = pkg.NewFairQueue()
+	// Routes contains result channels of the dispatched tasks by task id
+	Routes = pkg.NewSafeMap()
+	// Leases contains the tasks handed out to agents by task id until their results are posted
+	Leases = pkg.NewLeases()
+	// Agents contains the registered agents and the tasks handed out to them
+	Agents      = NewAgentRegistry()
 	Expressions = pkg.NewSafeMap()
+	// Outbox contains finished expressions until they are written to DB
+	Outbox = &pkg.Queue{}
+	// Events streams ExpressionEvent of the expressions by expression id
+	Events = pkg.NewPubSub()
 )
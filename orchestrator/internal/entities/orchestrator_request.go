@@ -1,8 +1,20 @@
 package entities
 
+// Modes of expression evaluation
+const (
+	// ModeFloat evaluates expressions with float64 numbers
+	ModeFloat = "float"
+	// ModeDecimal evaluates expressions exactly, results are returned as decimal strings
+	ModeDecimal = "decimal"
+)
+
 // ClientRequest is a struct that contains the request from the client
 type ClientRequest struct {
 	Expression string `json:"expression"`
+	// Mode is ModeFloat or ModeDecimal, ModeFloat is used if it is empty
+	Mode string `json:"mode,omitempty"`
+	// Priority orders the expressions of the user, expressions of higher priority are computed first
+	Priority int `json:"priority,omitempty"`
 }
 
 type RegisterRequest struct {
@@ -14,3 +26,7 @@ type LoginRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
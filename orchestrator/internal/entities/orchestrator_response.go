@@ -1,5 +1,10 @@
 package entities
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // ClientResponse is a struct that contains the response to the client
 type ClientResponse struct {
 	userId int
@@ -7,10 +12,23 @@ type ClientResponse struct {
 	Status string  `json:"status,omitempty"`
 	Result float64 `json:"result,omitempty"`
 	Error  string  `json:"error,omitempty"`
+	Mode   string  `json:"mode,omitempty"`
+	// Decimal is the exact result in ModeDecimal, it is sent to the client as the result
+	Decimal string `json:"-"`
+	// Operations is the number of operations of the expression computed by agents
+	Operations int        `json:"operations,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	// StartedAt is the time the orchestrator started evaluating the expression, it is reset when it is evaluated again after a restart
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
 }
 
 type LoginResponse struct {
-	Token string
+	Token string `json:"token"`
+	// RefreshToken is exchanged for new tokens at /api/v1/refresh once, it outlives the access token
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int `json:"expires_in"`
 }
 
 func (cr *ClientResponse) GetUserId() int {
@@ -20,3 +38,68 @@ func (cr *ClientResponse) GetUserId() int {
 func (cr *ClientResponse) SetUserId(userId int) {
 	cr.userId = userId
 }
+
+// MarshalJSON sends the result of ModeDecimal as a string, so it isn't rounded by clients parsing JSON numbers,
+// and adds the duration of the evaluation of finished expressions
+func (cr ClientResponse) MarshalJSON() ([]byte, error) {
+	type response ClientResponse
+	var duration *int64
+	if cr.StartedAt != nil && cr.FinishedAt != nil {
+		ms := cr.FinishedAt.Sub(*cr.StartedAt).Milliseconds()
+		duration = &ms
+	}
+	if cr.Mode != ModeDecimal {
+		return json.Marshal(struct {
+			response
+			DurationMs *int64 `json:"duration_ms,omitempty"`
+		}{response(cr), duration})
+	}
+	return json.Marshal(struct {
+		response
+		Result     string `json:"result,omitempty"`
+		DurationMs *int64 `json:"duration_ms,omitempty"`
+	}{response(cr), cr.Decimal, duration})
+}
+
+// Names of the events of an expression
+const (
+	// EventStatus is sent with ClientResponse whenever the status of the expression changes
+	EventStatus = "status"
+	// EventStep is sent with StepResult when an operation of the expression is computed
+	EventStep = "step"
+)
+
+// ExpressionEvent is a change of the expression streamed to the client
+type ExpressionEvent struct {
+	Name string
+	Data interface{}
+}
+
+// StepResult is the result of an operation of the expression
+type StepResult struct {
+	TaskId    string  `json:"task_id"`
+	Operation string  `json:"operation"`
+	Result    float64 `json:"result"`
+	Mode      string  `json:"-"`
+	// Decimal is the exact result in ModeDecimal, it is sent to the client as the result
+	Decimal      string `json:"-"`
+	ExpressionId int    `json:"-"`
+	// Step is the number of the operation in the expression, it is the same every time the expression is parsed
+	Step int `json:"-"`
+	// Args are the arguments of the operation, exact fractions in ModeDecimal
+	Args []string `json:"-"`
+	// Exact is the result in ModeDecimal as an exact fraction, the step is restored from it
+	Exact string `json:"-"`
+}
+
+// MarshalJSON sends the result of ModeDecimal as a string like ClientResponse does
+func (sr StepResult) MarshalJSON() ([]byte, error) {
+	type result StepResult
+	if sr.Mode != ModeDecimal {
+		return json.Marshal(result(sr))
+	}
+	return json.Marshal(struct {
+		result
+		Result string `json:"result"`
+	}{result(sr), sr.Decimal})
+}
@@ -1,10 +1,48 @@
 package entities
 
+import (
+	"fmt"
+	"strconv"
+)
+
 // Task is a struct that contains the task to be executed
 type Task struct {
-	Id            int     `json:"id,omitempty"`
-	Arg1          float64 `json:"arg1,omitempty"`
-	Arg2          float64 `json:"arg2,omitempty"`
-	Operation     string  `json:"operation,omitempty"`
-	OperationTime int     `json:"operation_time,omitempty"`
+	Id            string    `json:"id,omitempty"`
+	ExpressionId  int       `json:"expression_id,omitempty"`
+	Args          []float64 `json:"args,omitempty"`
+	Operation     string    `json:"operation,omitempty"`
+	OperationTime int       `json:"operation_time,omitempty"`
+	// Attempts is the number of times the task has been handed out to agents
+	Attempts int `json:"attempts,omitempty"`
+	// Mode is ModeDecimal if the task is computed exactly, its arguments are DecimalArgs then
+	Mode        string   `json:"mode,omitempty"`
+	DecimalArgs []string `json:"decimal_args,omitempty"`
+	// UserId is the owner of the expression, users take turns getting their tasks computed
+	UserId int `json:"user_id,omitempty"`
+	// Priority is the priority of the expression, tasks of higher priority are computed first among the user's tasks
+	Priority int `json:"priority,omitempty"`
+}
+
+// QueueKey puts the tasks of every user into a separate sub-queue of Tasks
+func (t Task) QueueKey() string {
+	return strconv.Itoa(t.UserId)
+}
+
+func (t Task) QueuePriority() int {
+	return t.Priority
+}
+
+// TaskResult is a result of the task computed by an agent
+type TaskResult struct {
+	Id     string
+	Result float64
+	// Decimal is the exact result of the task in ModeDecimal
+	Decimal string
+	// Err is set when the task could not be computed, the expression fails with it
+	Err error
+}
+
+// TaskId returns the id of the operation of the expression, e.g. "12.3" for the step 3 of the expression 12
+func TaskId(expressionId, step int) string {
+	return fmt.Sprintf("%d.%d", expressionId, step)
 }
@@ -0,0 +1,66 @@
+package grpc_server
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	obj "orchestrator/internal/entities"
+	"pkg"
+	"pkg/logger"
+	"time"
+)
+
+var (
+	// heartbeatIntervalMs is how often registered agents send heartbeats
+	heartbeatIntervalMs = pkg.GetEnvAsInt("AGENT_HEARTBEAT_INTERVAL_MS", 5000)
+	// agentTimeoutMs is the time after the last heartbeat when the agent is removed from the registry
+	agentTimeoutMs = pkg.GetEnvAsInt("AGENT_TIMEOUT_MS", 15000)
+)
+
+// registerAgent adds the agent to the registry
+func registerAgent(ctx context.Context, agent obj.Agent) error {
+	log := logger.GetLogger(ctx)
+	if agent.Id == "" {
+		return status.Error(codes.InvalidArgument, "Agent id is required")
+	}
+	obj.Agents.Register(agent, time.Now())
+	log.Info("Agent registered", "Id", agent.Id, "hostname", agent.Hostname, "computing_power", agent.ComputingPower)
+	return nil
+}
+
+// heartbeat keeps the agent in the registry, unknown agents have to register again
+func heartbeat(ctx context.Context, agentId string) error {
+	log := logger.GetLogger(ctx)
+	if agentId == "" {
+		return status.Error(codes.InvalidArgument, "Agent id is required")
+	}
+	if !obj.Agents.Heartbeat(agentId, time.Now()) {
+		log.Warn("Heartbeat from unknown agent", "Id", agentId)
+		return status.Error(codes.NotFound, "Agent is not registered")
+	}
+	return nil
+}
+
+// ExpireAgents removes the agents that have not sent heartbeats in time,
+// the tasks handed out to them are re-enqueued once their leases expire
+func ExpireAgents(ctx context.Context, now time.Time) {
+	log := logger.GetLogger(ctx)
+	deadline := now.Add(-time.Duration(agentTimeoutMs) * time.Millisecond)
+	for _, id := range obj.Agents.Expire(deadline) {
+		log.Warn("Agent expired", "Id", id)
+	}
+}
+
+// WatchAgents checks the registry every interval until the context is done
+func WatchAgents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ExpireAgents(ctx, now)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package grpc_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"orchestrator/internal/entities"
+	"os"
+	apiv2 "pkg/api/v2"
+	"pkg/logger"
+	"testing"
+	"time"
+)
+
+func TestRegisterAgent(t *testing.T) {
+	server := NewV2()
+	response, err := server.RegisterAgent(context.Background(), &apiv2.RegisterAgentRequest{
+		AgentId:        "agent-40",
+		Hostname:       "host",
+		ComputingPower: 2,
+		Operations:     []string{"+", "sqrt"},
+	})
+	defer entities.Agents.Expire(time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(heartbeatIntervalMs), response.HeartbeatIntervalMs)
+
+	agent, ok := entities.Agents.Get("agent-40")
+	assert.True(t, ok)
+	assert.Equal(t, "host", agent.Hostname)
+	assert.Equal(t, 2, agent.ComputingPower)
+	assert.Equal(t, []string{"+", "sqrt"}, agent.Operations)
+
+	_, err = server.Heartbeat(context.Background(), &apiv2.HeartbeatRequest{AgentId: "agent-40"})
+	assert.NoError(t, err)
+}
+
+func TestRegisterAgent_InvalidRequest(t *testing.T) {
+	server := NewV2()
+	_, err := server.RegisterAgent(context.Background(), &apiv2.RegisterAgentRequest{Hostname: "host"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.Heartbeat(context.Background(), &apiv2.HeartbeatRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestHeartbeat_UnknownAgent(t *testing.T) {
+	server := NewV2()
+	_, err := server.Heartbeat(context.Background(), &apiv2.HeartbeatRequest{AgentId: "agent-41"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGetTaskV2_CountsInFlightTasks(t *testing.T) {
+	server := NewV2()
+	entities.Agents.Register(entities.Agent{Id: "agent-42"}, time.Now())
+	defer entities.Agents.Expire(time.Now().Add(time.Hour))
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("42.1", &ch)
+	entities.Tasks.Enqueue(entities.Task{Id: "42.1", ExpressionId: 42, Args: []float64{1, 2}, Operation: "+", OperationTime: 100})
+
+	_, err := server.GetTask(context.Background(), &apiv2.GetTaskRequest{AgentId: "agent-42"})
+	assert.NoError(t, err)
+	agent, _ := entities.Agents.Get("agent-42")
+	assert.Equal(t, 1, agent.InFlight)
+
+	_, err = server.PostTask(context.Background(), &apiv2.PostTaskRequest{Id: 42, TaskId: "42.1", Result: 3})
+	assert.NoError(t, err)
+	agent, _ = entities.Agents.Get("agent-42")
+	assert.Equal(t, 0, agent.InFlight)
+	assert.Equal(t, 3.0, (<-ch).Result)
+}
+
+func TestExpireAgents(t *testing.T) {
+	ctx := logger.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	now := time.Now()
+	entities.Agents.Register(entities.Agent{Id: "agent-43"}, now)
+
+	// the agent is kept until it misses heartbeats for the timeout
+	ExpireAgents(ctx, now.Add(time.Duration(agentTimeoutMs)*time.Millisecond))
+	_, ok := entities.Agents.Get("agent-43")
+	assert.True(t, ok)
+
+	ExpireAgents(ctx, now.Add(time.Duration(agentTimeoutMs+1)*time.Millisecond))
+	_, ok = entities.Agents.Get("agent-43")
+	assert.False(t, ok)
+}
+
+func TestGetTaskV2_SkipsUnsupportedOperations(t *testing.T) {
+	server := NewV2()
+	entities.Agents.Register(entities.Agent{Id: "agent-44", Operations: []string{"+", "-"}}, time.Now())
+	defer entities.Agents.Expire(time.Now().Add(time.Hour))
+	power := entities.Task{Id: "44.1", ExpressionId: 44, Args: []float64{2, 3}, Operation: "^"}
+	entities.Tasks.Enqueue(power)
+	entities.Tasks.Enqueue(entities.Task{Id: "44.2", ExpressionId: 44, Args: []float64{1, 2}, Operation: "+"})
+	defer entities.Leases.Release("44.2")
+
+	// the registered agent gets the task it can compute
+	resp, err := server.GetTask(context.Background(), &apiv2.GetTaskRequest{AgentId: "agent-44"})
+	assert.NoError(t, err)
+	assert.Equal(t, "44.2", resp.TaskId)
+
+	// operations in the request take precedence over the registered ones
+	resp, err = server.GetTask(context.Background(), &apiv2.GetTaskRequest{AgentId: "agent-44", Operations: []string{"*"}})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = server.GetTask(context.Background(), &apiv2.GetTaskRequest{AgentId: "agent-44"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, power, entities.Tasks.Dequeue())
+}
@@ -0,0 +1,64 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	obj "orchestrator/internal/entities"
+	"pkg"
+	"pkg/logger"
+	"time"
+)
+
+var (
+	// leaseTimeoutMs is the time an agent has to post the result in addition to the operation time
+	leaseTimeoutMs = pkg.GetEnvAsInt("TASK_LEASE_TIMEOUT_MS", 10000)
+	// maxAttempts is the number of times a task is handed out before its expression fails
+	maxAttempts = pkg.GetEnvAsInt("TASK_MAX_ATTEMPTS", 3)
+)
+
+// leaseDeadline returns the time by which the result of the task must be posted
+func leaseDeadline(task obj.Task, now time.Time) time.Time {
+	return now.Add(time.Duration(task.OperationTime+leaseTimeoutMs) * time.Millisecond)
+}
+
+// ExpireLeases re-enqueues the tasks whose results were not posted in time,
+// the expression fails once a task runs out of attempts
+func ExpireLeases(ctx context.Context, now time.Time) {
+	log := logger.GetLogger(ctx)
+	for _, element := range obj.Leases.Expire(now) {
+		task := element.(obj.Task)
+		obj.Agents.Release(task.Id)
+		// the expression has already finished or failed, nobody waits for the result
+		if obj.Routes.Get(task.Id) == nil {
+			continue
+		}
+		if task.Attempts < maxAttempts {
+			log.Info("Task lease expired, task re-enqueued", "Id", task.Id, "attempts", task.Attempts)
+			obj.Tasks.Enqueue(task)
+			continue
+		}
+		ch, ok := obj.Routes.Pop(task.Id).(*chan obj.TaskResult)
+		if !ok {
+			continue
+		}
+		log.Error("Task lease expired, no attempts left", "Id", task.Id, "attempts", task.Attempts)
+		*ch <- obj.TaskResult{
+			Id:  task.Id,
+			Err: fmt.Errorf("operation %s was not completed by agents after %d attempts", task.Operation, task.Attempts),
+		}
+	}
+}
+
+// WatchLeases checks the leases every interval until the context is done
+func WatchLeases(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ExpireLeases(ctx, now)
+		}
+	}
+}
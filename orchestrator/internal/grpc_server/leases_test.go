@@ -0,0 +1,73 @@
+package grpc_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"orchestrator/internal/entities"
+	"os"
+	"pkg/api"
+	"pkg/logger"
+	"testing"
+	"time"
+)
+
+func TestGetTask_AcquiresLease(t *testing.T) {
+	server := New()
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("10.1", &ch)
+	entities.Tasks.Enqueue(entities.Task{Id: "10.1", ExpressionId: 10, Args: []float64{1, 2}, Operation: "+", OperationTime: 100})
+
+	_, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, entities.Leases.Len())
+
+	_, err = server.PostTask(context.Background(), &api.PostTaskRequest{Id: 10, TaskId: "10.1", Result: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, entities.Leases.Len())
+	assert.Equal(t, 3.0, (<-ch).Result)
+}
+
+func TestExpireLeases(t *testing.T) {
+	ctx := logger.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	now := time.Now()
+	tests := []struct {
+		name     string
+		attempts int
+		routed   bool
+		requeued bool
+		err      string
+	}{
+		{"attempts left", 1, true, true, ""},
+		{"no attempts left", maxAttempts, true, false, "operation + was not completed by agents after 3 attempts"},
+		{"expression finished", 1, false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := entities.Task{Id: "11.1", ExpressionId: 11, Args: []float64{1, 2}, Operation: "+", OperationTime: 100, Attempts: tt.attempts}
+			ch := make(chan entities.TaskResult, 1)
+			if tt.routed {
+				entities.Routes.Set(task.Id, &ch)
+			}
+			defer entities.Routes.Delete(task.Id)
+			entities.Leases.Acquire(task.Id, task, leaseDeadline(task, now))
+
+			// the lease is kept until its deadline
+			ExpireLeases(ctx, now)
+			assert.Equal(t, 1, entities.Leases.Len())
+
+			ExpireLeases(ctx, leaseDeadline(task, now).Add(time.Millisecond))
+			assert.Equal(t, 0, entities.Leases.Len())
+			requeued, _ := entities.Tasks.Dequeue().(entities.Task)
+			assert.Equal(t, tt.requeued, requeued.Id == task.Id)
+			if tt.err == "" {
+				assert.Empty(t, ch)
+				return
+			}
+			result := <-ch
+			assert.EqualError(t, result.Err, tt.err)
+			assert.Nil(t, entities.Routes.Get(task.Id))
+		})
+	}
+}
@@ -2,53 +2,135 @@ package grpc_server
 
 import (
 	"context"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 	"log/slog"
 	obj "orchestrator/internal/entities"
 	"os"
 	"pkg/api"
 	"pkg/logger"
+	"sync"
 )
 
+// Server implements the first version of the protocol, arguments and results are sent as float
 type Server struct {
 	api.OrchestratorServer
+	// leased contains the id of the task handed out by GetTask by expression id: the earliest agents post results
+	// without the task id, so GetTask hands out one task of an expression at a time and results are matched by expression id
+	leased map[int32]string
+	mutex  sync.Mutex
 }
 
 func New() *Server {
-	return &Server{}
+	return &Server{leased: make(map[int32]string)}
 }
 
-func (s *Server) GetTask(_ context.Context, _ *api.GetTaskRequest) (*api.GetTaskResponse, error) {
-	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	ctx := logger.WithLogger(context.Background(), serverLogger)
-	log := logger.GetLogger(ctx)
+// floatTasks accepts the tasks agents of the first version can compute, they don't support the decimal mode
+func floatTasks(task obj.Task) bool {
+	return task.Mode != obj.ModeDecimal
+}
+
+// binaryOperations are the operations the earliest agents compute, they read only arg1 and arg2
+var binaryOperations = map[string]bool{"+": true, "-": true, "*": true, "/": true}
 
-	if obj.Tasks.IsEmpty() {
-		return nil, status.Error(codes.NotFound, "No available tasks")
+// binaryTasks accepts the tasks the earliest agents can compute: + - * / of two arguments in the float mode
+func binaryTasks(task obj.Task) bool {
+	return floatTasks(task) && len(task.Args) == 2 && binaryOperations[task.Operation]
+}
+
+// idle accepts the tasks of the expressions without a task handed out by GetTask, the task is forgotten
+// once its lease is released or expired. The caller holds the mutex
+func (s *Server) idle(task obj.Task) bool {
+	taskId, ok := s.leased[int32(task.ExpressionId)]
+	if ok && obj.Leases.Get(taskId) == nil {
+		delete(s.leased, int32(task.ExpressionId))
+		ok = false
 	}
-	task := obj.Tasks.Dequeue().(obj.Task)
-	log.Info("Task dequeued with Id", "Id", task.Id)
-	return &api.GetTaskResponse{
-		Id:            int32(task.Id),
-		Arg1:          float32(task.Arg1),
-		Arg2:          float32(task.Arg2),
+	return !ok
+}
+
+// leasedTask returns the id of the task whose result is posted: taskId if the agent sent it,
+// otherwise the task handed out by GetTask for the expression
+func (s *Server) leasedTask(expressionId int32, taskId string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if taskId == "" {
+		taskId = s.leased[expressionId]
+	}
+	if s.leased[expressionId] == taskId {
+		delete(s.leased, expressionId)
+	}
+	return taskId
+}
+
+// taskV1 converts the task to the first version of the protocol
+func taskV1(task obj.Task) *api.GetTaskResponse {
+	response := &api.GetTaskResponse{
+		Id:            int32(task.ExpressionId),
+		TaskId:        task.Id,
+		Args:          make([]float32, len(task.Args)),
 		Operation:     task.Operation,
 		OperationTime: int32(task.OperationTime),
-	}, nil
+	}
+	for i, arg := range task.Args {
+		response.Args[i] = float32(arg)
+	}
+	if len(task.Args) > 0 {
+		response.Arg1 = response.Args[0]
+	}
+	if len(task.Args) > 1 {
+		response.Arg2 = response.Args[1]
+	}
+	return response
+}
+
+func (s *Server) GetTask(_ context.Context, _ *api.GetTaskRequest) (*api.GetTaskResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	task, err := nextTask(ctx, "", taskFilter(binaryTasks).and(s.idle), false)
+	if err != nil {
+		return nil, err
+	}
+	s.leased[int32(task.ExpressionId)] = task.Id
+	return taskV1(task), nil
 }
 
 func (s *Server) PostTask(_ context.Context, request *api.PostTaskRequest) (*api.PostTaskResponse, error) {
 	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	ctx := logger.WithLogger(context.Background(), serverLogger)
-	log := logger.GetLogger(ctx)
-	node := obj.ParsersTree.Search(int(request.Id))
-	if node == nil {
-		log.Error("Node not found")
-		return nil, status.Error(codes.NotFound, "Task not found")
-	}
-	ch := node.Value.(*chan float64)
-	*ch <- float64(request.Result)
-	log.Info("PostTask dequeued with Id", "Id", request.Id)
+	taskId := s.leasedTask(request.Id, request.TaskId)
+	if err := postResult(ctx, obj.TaskResult{Id: taskId, Result: float64(request.Result)}); err != nil {
+		return nil, err
+	}
 	return &api.PostTaskResponse{}, nil
 }
+
+func (s *Server) FailTask(_ context.Context, request *api.FailTaskRequest) (*api.FailTaskResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	if err := failTask(ctx, request.TaskId, request.Error); err != nil {
+		return nil, err
+	}
+	return &api.FailTaskResponse{}, nil
+}
+
+func (s *Server) Work(stream api.Orchestrator_WorkServer) error {
+	send := func(task obj.Task) error {
+		return stream.Send(&api.TaskAssignment{Task: taskV1(task)})
+	}
+	recv := func() (agentMessage, error) {
+		message, err := stream.Recv()
+		if err != nil {
+			return agentMessage{}, err
+		}
+		received := agentMessage{credits: int(message.Credits)}
+		if message.Result != nil {
+			received.taskId, received.result = message.Result.TaskId, float64(message.Result.Result)
+		}
+		if message.Failure != nil {
+			received.taskId, received.failure = message.Failure.TaskId, message.Failure.Error
+		}
+		return received, nil
+	}
+	return work(stream.Context(), floatTasks, send, recv)
+}
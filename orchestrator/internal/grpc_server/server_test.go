@@ -3,11 +3,17 @@ package grpc_server
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
 	"orchestrator/internal/entities"
+	"orchestrator/internal/parser"
 	"pkg/api"
+	"pkg/logger"
 	"testing"
+	"time"
 )
 
 func TestGetTask_EmptyQueue(t *testing.T) {
@@ -22,7 +28,7 @@ func TestGetTask_EmptyQueue(t *testing.T) {
 
 func TestGetTask_NonEmptyQueue(t *testing.T) {
 	server := New()
-	task := entities.Task{Id: 1, Arg1: 2.0, Arg2: 3.0, Operation: "+", OperationTime: 100}
+	task := entities.Task{Id: "1.1", ExpressionId: 1, Args: []float64{2.0, 3.0}, Operation: "+", OperationTime: 100}
 	entities.Tasks.Enqueue(task)
 
 	resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
@@ -30,33 +36,246 @@ func TestGetTask_NonEmptyQueue(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, resp)
 	assert.Equal(t, int32(1), resp.Id)
+	assert.Equal(t, "1.1", resp.TaskId)
 	assert.Equal(t, float32(2.0), resp.Arg1)
 	assert.Equal(t, float32(3.0), resp.Arg2)
+	assert.Equal(t, []float32{2.0, 3.0}, resp.Args)
 	assert.Equal(t, "+", resp.Operation)
 	assert.Equal(t, int32(100), resp.OperationTime)
 }
 
+// TestGetTask_SkipsNonBinaryTasks tests that GetTask hands out only the operations the earliest agents compute
+func TestGetTask_SkipsNonBinaryTasks(t *testing.T) {
+	server := New()
+	skipped := []entities.Task{
+		{Id: "2.1", ExpressionId: 2, Args: []float64{3, 7, 2}, Operation: "max"},
+		{Id: "2.2", ExpressionId: 2, Args: []float64{2, 3}, Operation: "^"},
+		{Id: "2.3", ExpressionId: 2, Args: []float64{4}, Operation: "~"},
+		{Id: "2.4", ExpressionId: 2, Args: []float64{16}, Operation: "sqrt"},
+	}
+	for _, task := range skipped {
+		entities.Tasks.Enqueue(task)
+	}
+
+	resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// the tasks wait for agents of the second version
+	for _, task := range skipped {
+		assert.Equal(t, task, entities.Tasks.Dequeue())
+	}
+}
+
 func TestPostTask_TaskNotFound(t *testing.T) {
 	server := New()
 
-	resp, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 1, Result: 5.0})
+	resp, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 1, TaskId: "1.1", Result: 5.0})
 
 	assert.Nil(t, resp)
 	assert.Error(t, err)
 	assert.Equal(t, codes.NotFound, status.Code(err))
 }
 
+func TestPostTask_MissingTaskId(t *testing.T) {
+	server := New()
+
+	resp, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 1, Result: 5.0})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestPostTask_WithoutTaskId tests that the result without the task id is matched to the task handed out for the expression
+func TestPostTask_WithoutTaskId(t *testing.T) {
+	server := New()
+	first := routeTask(entities.Task{Id: "11.1", ExpressionId: 11, Args: []float64{1, 2}, Operation: "+"})
+	second := routeTask(entities.Task{Id: "11.2", ExpressionId: 11, Args: []float64{3, 4}, Operation: "*"})
+
+	resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "11.1", resp.TaskId)
+	// the second task of the expression is not handed out until the result of the first one is posted
+	_, err = server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.PostTask(context.Background(), &api.PostTaskRequest{Id: 11, Result: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, entities.TaskResult{Id: "11.1", Result: 3}, <-first)
+	assert.Equal(t, 0, entities.Leases.Len())
+
+	resp, err = server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "11.2", resp.TaskId)
+	_, err = server.PostTask(context.Background(), &api.PostTaskRequest{Id: 11, TaskId: "11.2", Result: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, entities.TaskResult{Id: "11.2", Result: 12}, <-second)
+	_, err = server.PostTask(context.Background(), &api.PostTaskRequest{Id: 11, Result: 12})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestGetTask_AfterExpiredLease tests that the expression gets a task again once the lease of its task expires
+func TestGetTask_AfterExpiredLease(t *testing.T) {
+	server := New()
+	routeTask(entities.Task{Id: "12.1", ExpressionId: 12, Args: []float64{1, 2}, Operation: "+"})
+	defer entities.Routes.Pop("12.1")
+	ctx := logger.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	ExpireLeases(ctx, time.Now().Add(time.Hour))
+
+	resp, err = server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "12.1", resp.TaskId)
+	entities.Leases.Release("12.1")
+}
+
+// TestGetTask_BaselineAgent tests that an agent of the first release, which reads only arg1 and arg2 and posts results
+// without the task id, computes an expression with concurrent operations
+func TestGetTask_BaselineAgent(t *testing.T) {
+	client := dial(t)
+	ctx := logger.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	entities.Wg.Add(1)
+	go parser.Parse(ctx, entities.Expression{Id: 13, Expression: "(2 + 3) * (7 - 1) / 4", Mode: entities.ModeFloat})
+	defer entities.Expressions.Delete("13")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if expr, ok := entities.Expressions.Get("13").(entities.ClientResponse); ok && expr.Status != "In progress" {
+			assert.Equal(t, "Done", expr.Status)
+			assert.Equal(t, 7.5, expr.Result)
+			return
+		}
+		task, err := client.GetTask(ctx, &api.GetTaskRequest{})
+		if status.Code(err) == codes.NotFound {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		require.NoError(t, err)
+		var result float32
+		switch task.Operation {
+		case "+":
+			result = task.Arg1 + task.Arg2
+		case "-":
+			result = task.Arg1 - task.Arg2
+		case "*":
+			result = task.Arg1 * task.Arg2
+		case "/":
+			result = task.Arg1 / task.Arg2
+		default:
+			t.Fatalf("operation %s is handed out to the baseline agent", task.Operation)
+		}
+		_, err = client.PostTask(ctx, &api.PostTaskRequest{Id: task.Id, Result: result})
+		require.NoError(t, err)
+	}
+	t.Fatal("the expression is not computed by the baseline agent")
+}
+
 func TestPostTask_TaskFound(t *testing.T) {
 	server := New()
-	ch := make(chan float64, 1)
-	entities.ParsersTree.Insert(1, &ch)
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("1.2", &ch)
 
 	go func() {
-		resp, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 1, Result: 5.0})
+		resp, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 1, TaskId: "1.2", Result: 5.0})
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 	}()
 
 	result := <-ch
-	assert.Equal(t, 5.0, result)
+	assert.Equal(t, entities.TaskResult{Id: "1.2", Result: 5.0}, result)
+}
+
+func TestPostTask_Duplicate(t *testing.T) {
+	server := New()
+	ch := make(chan entities.TaskResult, 2)
+	entities.Routes.Set("2.1", &ch)
+	entities.Routes.Set("2.2", &ch)
+
+	_, err := server.PostTask(context.Background(), &api.PostTaskRequest{Id: 2, TaskId: "2.1", Result: 5.0})
+	assert.NoError(t, err)
+	_, err = server.PostTask(context.Background(), &api.PostTaskRequest{Id: 2, TaskId: "2.1", Result: 6.0})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Len(t, ch, 1)
+	assert.Equal(t, entities.TaskResult{Id: "2.1", Result: 5.0}, <-ch)
+}
+
+func TestFailTask(t *testing.T) {
+	server := New()
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("3.1", &ch)
+	entities.Leases.Acquire("3.1", entities.Task{Id: "3.1", ExpressionId: 3, Args: []float64{1e308, 10}, Operation: "*"}, time.Now().Add(time.Minute))
+
+	resp, err := server.FailTask(context.Background(), &api.FailTaskRequest{Id: 3, TaskId: "3.1", Error: "overflow"})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.EqualError(t, (<-ch).Err, "operation * failed: overflow")
+	assert.Equal(t, 0, entities.Leases.Len())
+	assert.Nil(t, entities.Routes.Get("3.1"))
+}
+
+func TestFailTask_InvalidRequest(t *testing.T) {
+	server := New()
+	tests := []struct {
+		name    string
+		request *api.FailTaskRequest
+		code    codes.Code
+	}{
+		{"missing task id", &api.FailTaskRequest{Id: 3, Error: "overflow"}, codes.InvalidArgument},
+		{"missing error", &api.FailTaskRequest{Id: 3, TaskId: "3.1"}, codes.InvalidArgument},
+		{"unknown task", &api.FailTaskRequest{Id: 3, TaskId: "3.9", Error: "overflow"}, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := server.FailTask(context.Background(), tt.request)
+
+			assert.Nil(t, resp)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestGetTask_SkipsDecimalTasks(t *testing.T) {
+	server := New()
+	decimal := entities.Task{Id: "4.1", ExpressionId: 4, DecimalArgs: []string{"1/10", "1/5"}, Operation: "+", Mode: entities.ModeDecimal}
+	entities.Tasks.Enqueue(decimal)
+	entities.Tasks.Enqueue(entities.Task{Id: "5.1", ExpressionId: 5, Args: []float64{1, 2}, Operation: "+"})
+	defer entities.Leases.Release("5.1")
+
+	resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "5.1", resp.TaskId)
+
+	// the decimal task waits for an agent of the second version
+	resp, err = server.GetTask(context.Background(), &api.GetTaskRequest{})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, decimal, entities.Tasks.Dequeue())
+}
+
+func TestGetTask_TakesTurnsBetweenUsers(t *testing.T) {
+	server := New()
+	for i, task := range []entities.Task{
+		{Id: "6.1", ExpressionId: 6, UserId: 1},
+		{Id: "9.1", ExpressionId: 9, UserId: 1},
+		{Id: "7.1", ExpressionId: 7, UserId: 1, Priority: 1},
+		{Id: "8.1", ExpressionId: 8, UserId: 2},
+	} {
+		task.Args, task.Operation = []float64{float64(i), 1}, "+"
+		entities.Tasks.Enqueue(task)
+		defer entities.Leases.Release(task.Id)
+	}
+
+	// the expression of higher priority goes first among the tasks of the user,
+	// the only task of the second user is not behind all the tasks of the first one
+	var ids []string
+	for i := 0; i < 4; i++ {
+		resp, err := server.GetTask(context.Background(), &api.GetTaskRequest{})
+		assert.NoError(t, err)
+		ids = append(ids, resp.TaskId)
+	}
+	assert.Equal(t, []string{"7.1", "8.1", "6.1", "9.1"}, ids)
 }
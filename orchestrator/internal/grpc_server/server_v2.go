@@ -0,0 +1,107 @@
+package grpc_server
+
+import (
+	"context"
+	"log/slog"
+	obj "orchestrator/internal/entities"
+	"os"
+	apiv2 "pkg/api/v2"
+	"pkg/logger"
+)
+
+// ServerV2 implements the second version of the protocol, arguments and results are sent as double
+type ServerV2 struct {
+	apiv2.OrchestratorServer
+}
+
+func NewV2() *ServerV2 {
+	return &ServerV2{}
+}
+
+// taskV2 converts the task to the second version of the protocol
+func taskV2(task obj.Task) *apiv2.GetTaskResponse {
+	return &apiv2.GetTaskResponse{
+		Id:            int32(task.ExpressionId),
+		TaskId:        task.Id,
+		Args:          task.Args,
+		Operation:     task.Operation,
+		OperationTime: int32(task.OperationTime),
+		Mode:          task.Mode,
+		DecimalArgs:   task.DecimalArgs,
+	}
+}
+
+func (s *ServerV2) GetTask(requestCtx context.Context, request *apiv2.GetTaskRequest) (*apiv2.GetTaskResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// the long poll ends with the request
+	ctx := logger.WithLogger(requestCtx, serverLogger)
+	task, err := nextTask(ctx, request.AgentId, supports(agentOperations(request.AgentId, request.Operations)), request.Wait)
+	if err != nil {
+		return nil, err
+	}
+	return taskV2(task), nil
+}
+
+func (s *ServerV2) PostTask(_ context.Context, request *apiv2.PostTaskRequest) (*apiv2.PostTaskResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	if err := postResult(ctx, obj.TaskResult{Id: request.TaskId, Result: request.Result, Decimal: request.DecimalResult}); err != nil {
+		return nil, err
+	}
+	return &apiv2.PostTaskResponse{}, nil
+}
+
+func (s *ServerV2) FailTask(_ context.Context, request *apiv2.FailTaskRequest) (*apiv2.FailTaskResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	if err := failTask(ctx, request.TaskId, request.Error); err != nil {
+		return nil, err
+	}
+	return &apiv2.FailTaskResponse{}, nil
+}
+
+func (s *ServerV2) Work(stream apiv2.Orchestrator_WorkServer) error {
+	send := func(task obj.Task) error {
+		return stream.Send(&apiv2.TaskAssignment{Task: taskV2(task)})
+	}
+	recv := func() (agentMessage, error) {
+		message, err := stream.Recv()
+		if err != nil {
+			return agentMessage{}, err
+		}
+		received := agentMessage{agentId: message.AgentId, credits: int(message.Credits)}
+		if message.Result != nil {
+			received.taskId, received.result = message.Result.TaskId, message.Result.Result
+			received.decimal = message.Result.DecimalResult
+		}
+		if message.Failure != nil {
+			received.taskId, received.failure = message.Failure.TaskId, message.Failure.Error
+		}
+		return received, nil
+	}
+	return work(stream.Context(), nil, send, recv)
+}
+
+func (s *ServerV2) RegisterAgent(_ context.Context, request *apiv2.RegisterAgentRequest) (*apiv2.RegisterAgentResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	agent := obj.Agent{
+		Id:             request.AgentId,
+		Hostname:       request.Hostname,
+		ComputingPower: int(request.ComputingPower),
+		Operations:     request.Operations,
+	}
+	if err := registerAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	return &apiv2.RegisterAgentResponse{HeartbeatIntervalMs: int32(heartbeatIntervalMs)}, nil
+}
+
+func (s *ServerV2) Heartbeat(_ context.Context, request *apiv2.HeartbeatRequest) (*apiv2.HeartbeatResponse, error) {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx := logger.WithLogger(context.Background(), serverLogger)
+	if err := heartbeat(ctx, request.AgentId); err != nil {
+		return nil, err
+	}
+	return &apiv2.HeartbeatResponse{}, nil
+}
@@ -0,0 +1,171 @@
+package grpc_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"orchestrator/internal/entities"
+	apiv2 "pkg/api/v2"
+	"testing"
+	"time"
+)
+
+func TestGetTaskV2_KeepsPrecision(t *testing.T) {
+	server := NewV2()
+	entities.Tasks.Enqueue(entities.Task{Id: "30.1", ExpressionId: 30, Args: []float64{0.1, 123456789.123456789}, Operation: "+", OperationTime: 100})
+	defer entities.Leases.Release("30.1")
+
+	resp, err := server.GetTask(context.Background(), &apiv2.GetTaskRequest{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(30), resp.Id)
+	assert.Equal(t, "30.1", resp.TaskId)
+	assert.Equal(t, []float64{0.1, 123456789.123456789}, resp.Args)
+}
+
+func TestPostTaskV2_KeepsPrecision(t *testing.T) {
+	server := NewV2()
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("30.2", &ch)
+
+	_, err := server.PostTask(context.Background(), &apiv2.PostTaskRequest{Id: 30, TaskId: "30.2", Result: 123456789.123456789})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 123456789.123456789, (<-ch).Result)
+}
+
+func TestTaskV2_Decimal(t *testing.T) {
+	server := NewV2()
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set("32.1", &ch)
+	entities.Tasks.Enqueue(entities.Task{Id: "32.1", ExpressionId: 32, DecimalArgs: []string{"1/10", "1/5"}, Operation: "+", Mode: entities.ModeDecimal})
+
+	resp, err := server.GetTask(context.Background(), &apiv2.GetTaskRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, entities.ModeDecimal, resp.Mode)
+	assert.Equal(t, []string{"1/10", "1/5"}, resp.DecimalArgs)
+	assert.Empty(t, resp.Args)
+
+	_, err = server.PostTask(context.Background(), &apiv2.PostTaskRequest{Id: 32, TaskId: "32.1", DecimalResult: "3/10"})
+	assert.NoError(t, err)
+	assert.Equal(t, "3/10", (<-ch).Decimal)
+}
+
+func TestFailTaskV2_TaskNotFound(t *testing.T) {
+	server := NewV2()
+
+	resp, err := server.FailTask(context.Background(), &apiv2.FailTaskRequest{Id: 30, TaskId: "30.9", Error: "overflow"})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestWorkV2_KeepsPrecision tests that the Work stream sends arguments and results as double
+func TestWorkV2_KeepsPrecision(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	apiv2.RegisterOrchestratorServer(srv, NewV2())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := apiv2.NewOrchestratorClient(conn).Work(ctx)
+	require.NoError(t, err)
+
+	ch := routeTask(entities.Task{Id: "31.1", ExpressionId: 31, Args: []float64{1e300, 1e-300}, Operation: "*"})
+	require.NoError(t, stream.Send(&apiv2.AgentMessage{Credits: 1}))
+	assignment, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1e300, 1e-300}, assignment.Task.Args)
+
+	require.NoError(t, stream.Send(&apiv2.AgentMessage{Result: &apiv2.PostTaskRequest{Id: 31, TaskId: "31.1", Result: 1.0000000000000002}}))
+	assert.Equal(t, 1.0000000000000002, (<-ch).Result)
+}
+
+// TestWorkV2_SkipsUnsupportedOperations tests that a registered agent is sent only the operations it can compute
+func TestWorkV2_SkipsUnsupportedOperations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	apiv2.RegisterOrchestratorServer(srv, NewV2())
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	entities.Agents.Register(entities.Agent{Id: "agent-33", Operations: []string{"+"}}, time.Now())
+	defer entities.Agents.Expire(time.Now().Add(time.Hour))
+	stream, err := apiv2.NewOrchestratorClient(conn).Work(ctx)
+	require.NoError(t, err)
+
+	sqrt := entities.Task{Id: "33.1", ExpressionId: 33, Args: []float64{4}, Operation: "sqrt"}
+	entities.Tasks.Enqueue(sqrt)
+	ch := routeTask(entities.Task{Id: "33.2", ExpressionId: 33, Args: []float64{1, 2}, Operation: "+"})
+	require.NoError(t, stream.Send(&apiv2.AgentMessage{AgentId: "agent-33", Credits: 2}))
+	assignment, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "33.2", assignment.Task.TaskId)
+	agent, _ := entities.Agents.Get("agent-33")
+	assert.Equal(t, 1, agent.InFlight)
+
+	require.NoError(t, stream.Send(&apiv2.AgentMessage{Result: &apiv2.PostTaskRequest{Id: 33, TaskId: "33.2", Result: 3}}))
+	assert.Equal(t, 3.0, (<-ch).Result)
+	assert.Equal(t, sqrt, entities.Tasks.Dequeue())
+}
+
+func TestGetTaskV2_Wait(t *testing.T) {
+	server := NewV2()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer entities.Leases.Release("34.1")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		entities.Tasks.Enqueue(entities.Task{Id: "34.1", ExpressionId: 34, Args: []float64{1, 2}, Operation: "+"})
+	}()
+
+	start := time.Now()
+	resp, err := server.GetTask(ctx, &apiv2.GetTaskRequest{Wait: true})
+	require.NoError(t, err)
+	assert.Equal(t, "34.1", resp.TaskId)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestGetTaskV2_WaitEnds(t *testing.T) {
+	server := NewV2()
+	tests := []struct {
+		name   string
+		cancel bool
+		code   codes.Code
+	}{
+		{"deadline", false, codes.NotFound},
+		{"canceled", true, codes.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			resp, err := server.GetTask(ctx, &apiv2.GetTaskRequest{Wait: true})
+			assert.Nil(t, resp)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
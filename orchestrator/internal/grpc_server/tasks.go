@@ -0,0 +1,142 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	obj "orchestrator/internal/entities"
+	"pkg"
+	"pkg/logger"
+	"time"
+)
+
+// longPollMaxMs is the longest time GetTask waits for a task
+var longPollMaxMs = pkg.GetEnvAsInt("TASK_LONG_POLL_MAX_MS", 30000)
+
+// taskFilter reports whether an agent can compute the task, a nil filter accepts any task
+type taskFilter func(obj.Task) bool
+
+// matches is used to dequeue only the tasks accepted by the filter
+func (f taskFilter) matches(element interface{}) bool {
+	return f == nil || f(element.(obj.Task))
+}
+
+// and accepts the tasks accepted by both filters
+func (f taskFilter) and(other taskFilter) taskFilter {
+	if f == nil {
+		return other
+	}
+	if other == nil {
+		return f
+	}
+	return func(task obj.Task) bool {
+		return f(task) && other(task)
+	}
+}
+
+// supports accepts the tasks whose operations are in the list, any task is accepted if the list is empty
+func supports(operations []string) taskFilter {
+	if len(operations) == 0 {
+		return nil
+	}
+	supported := make(map[string]bool, len(operations))
+	for _, operation := range operations {
+		supported[operation] = true
+	}
+	return func(task obj.Task) bool {
+		return supported[task.Operation]
+	}
+}
+
+// agentOperations returns the operations the agent advertised in the request or when it registered
+func agentOperations(agentId string, advertised []string) []string {
+	if len(advertised) > 0 {
+		return advertised
+	}
+	agent, _ := obj.Agents.Get(agentId)
+	return agent.Operations
+}
+
+// handOut leases the task to the agent and returns it with the attempt counted,
+// the agent id is empty for agents that are not registered
+func handOut(task obj.Task, agentId string) obj.Task {
+	task.Attempts++
+	obj.Leases.Acquire(task.Id, task, leaseDeadline(task, time.Now()))
+	obj.Agents.Assign(agentId, task.Id)
+	return task
+}
+
+// release removes the lease of the task and returns the leased task, nil is returned if it is not leased
+func release(taskId string) interface{} {
+	obj.Agents.Release(taskId)
+	return obj.Leases.Release(taskId)
+}
+
+// nextTask dequeues the first task accepted by the filter and leases it to the agent. If wait is set,
+// it waits for the task until the context is done, but no longer than longPollMaxMs
+func nextTask(ctx context.Context, agentId string, accepts taskFilter, wait bool) (obj.Task, error) {
+	log := logger.GetLogger(ctx)
+	var element interface{}
+	if wait {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(longPollMaxMs)*time.Millisecond)
+		defer cancel()
+		var err error
+		element, err = obj.Tasks.DequeueWaitFunc(ctx, accepts.matches)
+		if errors.Is(err, context.Canceled) {
+			return obj.Task{}, status.FromContextError(err).Err()
+		}
+	} else {
+		element = obj.Tasks.DequeueFunc(accepts.matches)
+	}
+	if element == nil {
+		return obj.Task{}, status.Error(codes.NotFound, "No available tasks")
+	}
+	task := handOut(element.(obj.Task), agentId)
+	log.Info("Task dequeued with Id", "Id", task.Id)
+	return task, nil
+}
+
+// postResult delivers the result of the task to its expression
+func postResult(ctx context.Context, result obj.TaskResult) error {
+	log := logger.GetLogger(ctx)
+	taskId := result.Id
+	if taskId == "" {
+		return status.Error(codes.InvalidArgument, "Task id is required")
+	}
+	release(taskId)
+	// the route is removed, so a duplicate or late result is never delivered to the expression again
+	ch, ok := obj.Routes.Pop(taskId).(*chan obj.TaskResult)
+	if !ok {
+		log.Error("Task not found", "Id", taskId)
+		return status.Error(codes.NotFound, "Task not found")
+	}
+	*ch <- result
+	log.Info("PostTask dequeued with Id", "Id", taskId)
+	return nil
+}
+
+// failTask fails the expression of the task with the reason reported by the agent
+func failTask(ctx context.Context, taskId string, reason string) error {
+	log := logger.GetLogger(ctx)
+	if taskId == "" {
+		return status.Error(codes.InvalidArgument, "Task id is required")
+	}
+	if reason == "" {
+		return status.Error(codes.InvalidArgument, "Error is required")
+	}
+	err := fmt.Errorf("task %s failed: %s", taskId, reason)
+	if task, ok := release(taskId).(obj.Task); ok {
+		err = fmt.Errorf("operation %s failed: %s", task.Operation, reason)
+	}
+	ch, ok := obj.Routes.Pop(taskId).(*chan obj.TaskResult)
+	if !ok {
+		log.Error("Task not found", "Id", taskId)
+		return status.Error(codes.NotFound, "Task not found")
+	}
+	*ch <- obj.TaskResult{Id: taskId, Err: err}
+	log.Info("FailTask: expression failed", "Id", taskId, "err", reason)
+	return nil
+}
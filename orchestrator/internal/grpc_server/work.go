@@ -0,0 +1,176 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	obj "orchestrator/internal/entities"
+	"os"
+	"pkg/logger"
+	"sync"
+)
+
+// session is the state of the Work stream of one agent
+type session struct {
+	mutex sync.Mutex
+	// credits is the number of tasks the agent is ready to take
+	credits int
+	// granted is signalled when the agent grants credits
+	granted chan struct{}
+	// assigned contains ids of the tasks sent to the agent whose results are not received yet
+	assigned map[string]struct{}
+	// agentId is the id of the registered agent, it is empty until the agent sends it
+	agentId string
+}
+
+func newSession() *session {
+	return &session{granted: make(chan struct{}, 1), assigned: make(map[string]struct{})}
+}
+
+// grant adds credits and wakes up the waiting sender
+func (ss *session) grant(credits int) {
+	ss.mutex.Lock()
+	ss.credits += credits
+	ss.mutex.Unlock()
+	select {
+	case ss.granted <- struct{}{}:
+	default:
+	}
+}
+
+// take waits until the agent has a credit and consumes it
+func (ss *session) take(ctx context.Context) error {
+	for {
+		ss.mutex.Lock()
+		if ss.credits > 0 {
+			ss.credits--
+			ss.mutex.Unlock()
+			return nil
+		}
+		ss.mutex.Unlock()
+
+		select {
+		case <-ss.granted:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// identify sets the id of the agent, tasks sent to it are counted in the registry from then on
+func (ss *session) identify(agentId string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.agentId = agentId
+}
+
+func (ss *session) agent() string {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.agentId
+}
+
+func (ss *session) assign(taskId string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.assigned[taskId] = struct{}{}
+}
+
+func (ss *session) done(taskId string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	delete(ss.assigned, taskId)
+}
+
+// requeue returns the tasks the agent has not computed to the queue, so other agents
+// don't have to wait for their leases to expire
+func (ss *session) requeue() {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	for taskId := range ss.assigned {
+		task, ok := release(taskId).(obj.Task)
+		if ok && obj.Routes.Get(taskId) != nil {
+			obj.Tasks.Enqueue(task)
+		}
+	}
+}
+
+// agentMessage is a message of the Work stream in any version of the protocol
+type agentMessage struct {
+	agentId string
+	credits int
+	// taskId is set when the message reports the result of the task or the error computing it
+	taskId  string
+	result  float64
+	decimal string
+	failure string
+}
+
+// work sends tasks accepted by the filter to the agent as soon as they are enqueued while the agent has credits,
+// a registered agent gets only the operations it can compute, results and errors of the tasks are received on the same stream
+func work(streamCtx context.Context, accepts taskFilter, send func(obj.Task) error, recv func() (agentMessage, error)) error {
+	serverLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	ctx, cancel := context.WithCancel(logger.WithLogger(streamCtx, serverLogger))
+	defer cancel()
+	log := logger.GetLogger(ctx)
+
+	ss := newSession()
+	defer ss.requeue()
+	received := make(chan error, 1)
+	go func() {
+		received <- receive(ctx, recv, ss)
+		cancel()
+	}()
+
+	for {
+		if err := ss.take(ctx); err != nil {
+			break
+		}
+		// the agent sends its id with the first credits, so it is known by the time a task is dequeued
+		filter := accepts.and(supports(agentOperations(ss.agent(), nil)))
+		element, err := obj.Tasks.DequeueWaitFunc(ctx, filter.matches)
+		if err != nil {
+			break
+		}
+		task := handOut(element.(obj.Task), ss.agent())
+		ss.assign(task.Id)
+		if err = send(task); err != nil {
+			log.Error("Work: send task error:", "err", err)
+			return err
+		}
+		log.Info("Work: task sent with Id", "Id", task.Id)
+	}
+	return <-received
+}
+
+// receive handles the messages of the agent until it closes the stream
+func receive(ctx context.Context, recv func() (agentMessage, error), ss *session) error {
+	log := logger.GetLogger(ctx)
+	for {
+		message, err := recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if message.agentId != "" {
+			ss.identify(message.agentId)
+		}
+		if message.taskId != "" {
+			ss.done(message.taskId)
+			if message.failure != "" {
+				err = failTask(ctx, message.taskId, message.failure)
+			} else {
+				err = postResult(ctx, obj.TaskResult{Id: message.taskId, Result: message.result, Decimal: message.decimal})
+			}
+			if err != nil {
+				log.Error("Work: task report error:", "err", err)
+			}
+		}
+		if message.credits > 0 {
+			ss.grant(message.credits)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package grpc_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"orchestrator/internal/entities"
+	"pkg/api"
+	"testing"
+	"time"
+)
+
+// dial starts the server on an in-memory listener and connects to it
+func dial(t *testing.T) api.OrchestratorClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	api.RegisterOrchestratorServer(srv, New())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return api.NewOrchestratorClient(conn)
+}
+
+// startWork starts the server on an in-memory listener and opens the Work stream
+func startWork(t *testing.T, ctx context.Context) api.Orchestrator_WorkClient {
+	stream, err := dial(t).Work(ctx)
+	require.NoError(t, err)
+	return stream
+}
+
+// routeTask enqueues the task and returns the channel its result is delivered to
+func routeTask(task entities.Task) chan entities.TaskResult {
+	ch := make(chan entities.TaskResult, 1)
+	entities.Routes.Set(task.Id, &ch)
+	entities.Tasks.Enqueue(task)
+	return ch
+}
+
+func TestWork_Credits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := startWork(t, ctx)
+
+	first := routeTask(entities.Task{Id: "20.1", ExpressionId: 20, Args: []float64{1, 2}, Operation: "+"})
+	second := routeTask(entities.Task{Id: "20.2", ExpressionId: 20, Args: []float64{3, 4}, Operation: "*"})
+	require.NoError(t, stream.Send(&api.AgentMessage{Credits: 1}))
+
+	assignment, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "20.1", assignment.Task.TaskId)
+	assert.Equal(t, []float32{1, 2}, assignment.Task.Args)
+
+	// the second task waits in the queue until the agent grants a credit
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, entities.Tasks.IsEmpty())
+
+	require.NoError(t, stream.Send(&api.AgentMessage{Credits: 1, Result: &api.PostTaskRequest{Id: 20, TaskId: "20.1", Result: 3}}))
+	assert.Equal(t, 3.0, (<-first).Result)
+
+	assignment, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "20.2", assignment.Task.TaskId)
+
+	require.NoError(t, stream.Send(&api.AgentMessage{Failure: &api.FailTaskRequest{Id: 20, TaskId: "20.2", Error: "overflow"}}))
+	assert.EqualError(t, (<-second).Err, "operation * failed: overflow")
+	assert.Equal(t, 0, entities.Leases.Len())
+}
+
+func TestWork_PushesEnqueuedTask(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := startWork(t, ctx)
+	require.NoError(t, stream.Send(&api.AgentMessage{Credits: 1}))
+
+	received := make(chan *api.TaskAssignment)
+	go func() {
+		assignment, _ := stream.Recv()
+		received <- assignment
+	}()
+	// the task is enqueued after the agent started waiting
+	time.Sleep(50 * time.Millisecond)
+	ch := routeTask(entities.Task{Id: "21.1", ExpressionId: 21, Args: []float64{2}, Operation: "sqrt"})
+
+	assignment := <-received
+	require.NotNil(t, assignment)
+	assert.Equal(t, "21.1", assignment.Task.TaskId)
+	require.NoError(t, stream.Send(&api.AgentMessage{Result: &api.PostTaskRequest{Id: 21, TaskId: "21.1", Result: 1.5}}))
+	assert.Equal(t, 1.5, (<-ch).Result)
+}
+
+func TestWork_RequeuesUnfinishedTasks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := startWork(t, ctx)
+
+	routeTask(entities.Task{Id: "22.1", ExpressionId: 22, Args: []float64{1, 2}, Operation: "+"})
+	defer entities.Routes.Delete("22.1")
+	require.NoError(t, stream.Send(&api.AgentMessage{Credits: 1}))
+	_, err := stream.Recv()
+	require.NoError(t, err)
+
+	// the agent goes away without computing the task
+	require.NoError(t, stream.CloseSend())
+	task, err := entities.Tasks.DequeueWait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "22.1", task.(entities.Task).Id)
+	assert.Equal(t, 1, task.(entities.Task).Attempts)
+	assert.Equal(t, 0, entities.Leases.Len())
+}
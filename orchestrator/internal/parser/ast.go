@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxExpressionLength is the longest expression in bytes, it bounds the height of the syntax tree
+	MaxExpressionLength = 10000
+	// maxDepth is the deepest nesting of parentheses, function calls, unary operators and powers,
+	// the parser and the evaluation of the tree are recursive and must not overflow the stack
+	maxDepth = 200
+)
+
+// Node is a node of the expression syntax tree
+type Node interface {
+	// Position returns the byte offset of the node in the expression
+	Position() int
+	String() string
+}
+
+// Number is a numeric literal, Text is the literal as written in the expression
+type Number struct {
+	Value float64
+	Text  string
+	Pos   int
+}
+
+func (n *Number) Position() int {
+	return n.Pos
+}
+
+func (n *Number) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+// Operation is an operator or a function call that agents execute as a single task.
+// Unary minus is represented by the unaryMinus operator with one argument
+type Operation struct {
+	Operator string
+	Args     []Node
+	Pos      int
+}
+
+func (o *Operation) Position() int {
+	return o.Pos
+}
+
+// String returns the operation in prefix notation, e.g. (+ 1 (* 2 3))
+func (o *Operation) String() string {
+	parts := make([]string, 0, len(o.Args)+1)
+	parts = append(parts, o.Operator)
+	for _, arg := range o.Args {
+		parts = append(parts, arg.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// astParser is a recursive descent parser over the tokens of the expression.
+//
+//	expression     = multiplicative { ("+" | "-") multiplicative }
+//	multiplicative = unary { ("*" | "/" | "%" | "//") unary }
+//	unary          = ("+" | "-") unary | power
+//	power          = primary [ "^" unary ]
+//	primary        = number | function "(" expression { "," expression } ")" | "(" expression ")"
+type astParser struct {
+	tokens []token
+	pos    int
+	// depth is the current nesting of the parsed operand
+	depth int
+}
+
+// ParseExpression builds the syntax tree of the expression, syntax errors are returned as *ParseError
+func ParseExpression(expression string) (Node, error) {
+	if len(expression) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d bytes", MaxExpressionLength)
+	}
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &astParser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &ParseError{Pos: 0, Expected: "expression", Got: p.peek().String()}
+	}
+	node, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &ParseError{Pos: tok.pos, Expected: "operator", Got: tok.String()}
+	}
+	return node, nil
+}
+
+// peek returns the current token without consuming it
+func (p *astParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes the current token
+func (p *astParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isOperator reports whether the current token is one of the operators
+func (p *astParser) isOperator(operators ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokenOperator {
+		return false
+	}
+	for _, operator := range operators {
+		if tok.text == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *astParser) expression() (Node, error) {
+	left, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		tok := p.next()
+		right, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &Operation{Operator: tok.text, Args: []Node{left, right}, Pos: tok.pos}
+	}
+	return left, nil
+}
+
+func (p *astParser) multiplicative() (Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "%", "//") {
+		tok := p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Operation{Operator: tok.text, Args: []Node{left, right}, Pos: tok.pos}
+	}
+	return left, nil
+}
+
+// unary is entered on every level of nesting, so the depth is checked here
+func (p *astParser) unary() (Node, error) {
+	if p.depth >= maxDepth {
+		tok := p.peek()
+		return nil, &ParseError{Pos: tok.pos, Expected: fmt.Sprintf("at most %d nested operations", maxDepth), Got: tok.String()}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	if !p.isOperator("+", "-") {
+		return p.power()
+	}
+	tok := p.next()
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	// unary plus does not change the value
+	if tok.text == "+" {
+		return operand, nil
+	}
+	return &Operation{Operator: unaryMinus, Args: []Node{operand}, Pos: tok.pos}, nil
+}
+
+func (p *astParser) power() (Node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("^") {
+		return base, nil
+	}
+	tok := p.next()
+	// '^' is right-associative and binds tighter than unary minus on its left: -2^2 = -(2^2)
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &Operation{Operator: "^", Args: []Node{base, exponent}, Pos: tok.pos}, nil
+}
+
+func (p *astParser) primary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, &ParseError{Pos: tok.pos, Expected: "number", Got: tok.String()}
+		}
+		return &Number{Value: value, Text: tok.text, Pos: tok.pos}, nil
+	case tokenLParen:
+		node, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &ParseError{Pos: closing.pos, Expected: "')'", Got: closing.String()}
+		}
+		return node, nil
+	case tokenIdent:
+		return p.call(tok)
+	default:
+		return nil, &ParseError{Pos: tok.pos, Expected: "operand", Got: tok.String()}
+	}
+}
+
+// call parses the arguments of the function whose name is already consumed
+func (p *astParser) call(name token) (Node, error) {
+	if !IsFunction(name.text) {
+		return nil, &ParseError{Pos: name.pos, Expected: "function name", Got: name.String()}
+	}
+	if open := p.next(); open.kind != tokenLParen {
+		return nil, &ParseError{Pos: open.pos, Expected: "'(' after " + name.text, Got: open.String()}
+	}
+	var args []Node
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		tok := p.next()
+		if tok.kind == tokenRParen {
+			break
+		}
+		if tok.kind != tokenComma {
+			return nil, &ParseError{Pos: tok.pos, Expected: "',' or ')'", Got: tok.String()}
+		}
+	}
+	if a := functions[name.text]; !a.allows(len(args)) {
+		return nil, &ParseError{Pos: name.pos, Expected: a.String() + " for " + name.text, Got: plural(len(args), "argument")}
+	}
+	return &Operation{Operator: name.text, Args: args, Pos: name.pos}, nil
+}
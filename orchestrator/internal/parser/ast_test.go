@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       string
+	}{
+		{"precedence", "1 + 2 * 3", "(+ 1 (* 2 3))"},
+		{"left associativity", "8 - 4 - 2", "(- (- 8 4) 2)"},
+		{"parentheses", "(1 + 2) * 3", "(* (+ 1 2) 3)"},
+		{"unary minus", "-3 + 5", "(+ (~ 3) 5)"},
+		{"unary minus in parentheses", "2 * (-4)", "(* 2 (~ 4))"},
+		{"negated group", "(-(1+2))", "(~ (+ 1 2))"},
+		{"unary plus", "+3 - +2", "(- 3 2)"},
+		{"power is right-associative", "2 ^ 3 ^ 2", "(^ 2 (^ 3 2))"},
+		{"power binds tighter than unary minus", "-2 ^ 2", "(~ (^ 2 2))"},
+		{"negative exponent", "2 ^ -1", "(^ 2 (~ 1))"},
+		{"modulo and integer division", "7 % 4 // 2 / 1", "(/ (// (% 7 4) 2) 1)"},
+		{"literals", "3.14 + .5 + 1e-3", "(+ (+ 3.14 0.5) 0.001)"},
+		{"function calls", "sqrt(16) + max(3, 7, 2)", "(+ (sqrt 16) (max 3 7 2))"},
+		{"nested function calls", "-min(abs(-2), 2 * 3)", "(~ (min (abs (~ 2)) (* 2 3)))"},
+		{"deepest nesting", strings.Repeat("(", maxDepth-1) + "1" + strings.Repeat(")", maxDepth-1), "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ParseExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q) error = %v", tt.expression, err)
+			}
+			if node.String() != tt.want {
+				t.Errorf("ParseExpression(%q) = %s; want %s", tt.expression, node, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       string
+	}{
+		{"empty", " ", "expected expression, got end of expression at position 1"},
+		{"missing operand", "2 * * 3", "expected operand, got '*' at position 5"},
+		{"trailing operator", "1 +", "expected operand, got end of expression at position 4"},
+		{"missing open parenthesis", "1 + 2)", "expected operator, got ')' at position 6"},
+		{"missing close parenthesis", "(1 + 2", "expected ')', got end of expression at position 7"},
+		{"unknown function", "2 + tan(1)", "expected function name, got 'tan' at position 5"},
+		{"function without call", "sqrt 4", "expected '(' after sqrt, got '4' at position 6"},
+		{"too many arguments", "sqrt(1, 2)", "expected 1 argument for sqrt, got 2 arguments at position 1"},
+		{"missing argument", "max()", "expected operand, got ')' at position 5"},
+		{"comma outside of call", "(1, 2)", "expected ')', got ',' at position 3"},
+		{"malformed number", "1..2", "expected digit, got '.' at position 3"},
+		{"too deep negation", strings.Repeat("-", maxDepth) + "1", "expected at most 200 nested operations, got '1' at position 201"},
+		{"too deep parentheses", strings.Repeat("(", maxDepth) + "1" + strings.Repeat(")", maxDepth), "expected at most 200 nested operations, got '1' at position 201"},
+		{"too deep powers", strings.Repeat("2^", maxDepth) + "2", "expected at most 200 nested operations, got '2' at position 401"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExpression(tt.expression)
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("ParseExpression(%q) error = %v; want *ParseError", tt.expression, err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("ParseExpression(%q) error = %q; want %q", tt.expression, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	_, err := ParseExpression("2 + (3 * )")
+	want := "expected operand, got ')' at position 10\n2 + (3 * )\n         ^"
+	if got := ErrorMessage("2 + (3 * )", err); got != want {
+		t.Errorf("ErrorMessage() = %q; want %q", got, want)
+	}
+}
+
+// TestParseExpressionLength tests that long expressions are rejected before they are parsed,
+// so they can't overflow the stack of the recursive parser
+func TestParseExpressionLength(t *testing.T) {
+	if _, err := ParseExpression(strings.Repeat("-", 5_000_000) + "1"); err == nil || err.Error() != "expression is longer than 10000 bytes" {
+		t.Errorf("ParseExpression(long expression) error = %v; want length error", err)
+	}
+	long := strings.Repeat("1+", (MaxExpressionLength-1)/2) + "1"
+	node, err := ParseExpression(long)
+	if err != nil {
+		t.Fatalf("ParseExpression(%d bytes) error = %v", len(long), err)
+	}
+	if got := countOperations(node); got != (MaxExpressionLength-1)/2 {
+		t.Errorf("countOperations() = %d; want %d", got, (MaxExpressionLength-1)/2)
+	}
+}
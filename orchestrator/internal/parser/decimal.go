@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	obj "orchestrator/internal/entities"
+	"strconv"
+	"strings"
+)
+
+// decimalDigits is the number of digits after the point of decimal results that are infinite fractions, e.g. 1/3
+const decimalDigits = 20
+
+const (
+	// maxDecimalExponent limits exponents in the decimal mode, including exponents of literals such as 1e-3
+	maxDecimalExponent = 10000
+	// maxDecimalBits limits the numerator and the denominator of exact results,
+	// larger numbers take minutes and gigabytes to compute and to format
+	maxDecimalBits = 1 << 17
+)
+
+// decimalOperations contains operations agents can compute exactly in the decimal mode
+var decimalOperations = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "^": true, "%": true, "//": true, unaryMinus: true,
+	"abs": true, "min": true, "max": true,
+}
+
+// value is a number computed by the expression, exact is set instead of float in the decimal mode
+type value struct {
+	float float64
+	exact *big.Rat
+}
+
+// sign returns -1, 0 or 1 for negative, zero and positive values
+func (v value) sign() int {
+	if v.exact != nil {
+		return v.exact.Sign()
+	}
+	switch {
+	case v.float < 0:
+		return -1
+	case v.float > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// numberValue returns the value of the literal in the mode
+func numberValue(n *Number, mode string) (value, error) {
+	if mode != obj.ModeDecimal {
+		return value{float: n.Value}, nil
+	}
+	exact, err := parseDecimal(n.Text)
+	if err != nil {
+		return value{}, err
+	}
+	return value{exact: exact}, nil
+}
+
+// parseDecimal parses the exact number, e.g. 0.1, 1e-3 or 1/3. Exponents are limited like in powers,
+// since the number is multiplied by 10 to the exponent
+func parseDecimal(text string) (*big.Rat, error) {
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(text[i+1:])
+		if errors.Is(err, strconv.ErrRange) || err == nil && (exponent > maxDecimalExponent || exponent < -maxDecimalExponent) {
+			return nil, fmt.Errorf("exponent of %s is too large for decimal mode", text)
+		}
+	}
+	exact, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %s", text)
+	}
+	return exact, nil
+}
+
+// ratBits returns the size of the larger of the numerator and the denominator in bits
+func ratBits(r *big.Rat) int64 {
+	return int64(max(r.Num().BitLen(), r.Denom().BitLen()))
+}
+
+// CheckMode returns an error if the expression can't be evaluated in the mode
+func CheckMode(tree Node, mode string) error {
+	switch mode {
+	case obj.ModeFloat:
+		return nil
+	case obj.ModeDecimal:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s or %s", mode, obj.ModeFloat, obj.ModeDecimal)
+	}
+	op, ok := tree.(*Operation)
+	if !ok {
+		return nil
+	}
+	if !decimalOperations[op.Operator] {
+		return &ParseError{Pos: op.Pos, Expected: "operation supported in decimal mode", Got: "'" + op.Operator + "'"}
+	}
+	for _, arg := range op.Args {
+		if err := CheckMode(arg, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDecimalPower returns an error if the exact power can't be computed
+func checkDecimalPower(base, exponent *big.Rat) error {
+	if !exponent.IsInt() {
+		return errors.New("decimal mode supports only integer exponents")
+	}
+	if new(big.Rat).Abs(exponent).Cmp(big.NewRat(maxDecimalExponent, 1)) > 0 {
+		return errors.New("exponent is too large for decimal mode")
+	}
+	if base.Sign() == 0 && exponent.Sign() < 0 {
+		return errors.New("division by zero")
+	}
+	// the power has at most |exponent| times as many bits as the base
+	if ratBits(base)*new(big.Int).Abs(exponent.Num()).Int64() > maxDecimalBits {
+		return errors.New("power is too large for decimal mode")
+	}
+	return nil
+}
+
+// checkDecimalSize returns an error if the exact result of the arithmetic operator may be larger than maxDecimalBits,
+// its numerator and denominator have at most as many bits as the arguments together
+func checkDecimalSize(a, b *big.Rat) error {
+	if ratBits(a)+ratBits(b) > maxDecimalBits {
+		return errors.New("result is too large for decimal mode")
+	}
+	return nil
+}
+
+// formatDecimal returns the decimal notation of the number, infinite fractions are rounded to decimalDigits
+func formatDecimal(r *big.Rat) string {
+	digits, finite := fractionDigits(r.Denom())
+	if finite {
+		return r.FloatString(digits)
+	}
+	s := strings.TrimSuffix(strings.TrimRight(r.FloatString(decimalDigits), "0"), ".")
+	// negative numbers rounded to zero are not negative anymore
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// fractionDigits returns the number of digits after the point of 1/denom,
+// finite is false if the denominator has prime factors other than 2 and 5
+func fractionDigits(denom *big.Int) (digits int, finite bool) {
+	d := new(big.Int).Set(denom)
+	twos := int(d.TrailingZeroBits())
+	d.Rsh(d, uint(twos))
+	fives := 0
+	five, remainder := big.NewInt(5), new(big.Int)
+	for {
+		quotient, _ := new(big.Int).QuoRem(d, five, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		d = quotient
+		fives++
+	}
+	return max(twos, fives), d.Cmp(big.NewInt(1)) == 0
+}
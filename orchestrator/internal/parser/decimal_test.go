@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"math/big"
+	obj "orchestrator/internal/entities"
+	"testing"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		rat  string
+		want string
+	}{
+		{"5", "5"},
+		{"-3/10", "-0.3"},
+		{"1/8", "0.125"},
+		{"1/3", "0.33333333333333333333"},
+		{"-2/3", "-0.66666666666666666667"},
+		{"1/1000000000000000000000000", "0.000000000000000000000001"},
+		{"1/30000000000000000000000", "0"},
+		{"-1/30000000000000000000000", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rat, func(t *testing.T) {
+			r, _ := new(big.Rat).SetString(tt.rat)
+			if got := formatDecimal(r); got != tt.want {
+				t.Errorf("formatDecimal(%s) = %s; want %s", tt.rat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	tests := []struct {
+		expression string
+		mode       string
+		err        string
+	}{
+		{"sqrt(2) + sin(1)", obj.ModeFloat, ""},
+		{"-(0.1 + 0.2) * 3 / 7 % 2 // 1 ^ 2", obj.ModeDecimal, ""},
+		{"abs(-1) + min(1, 2) + max(1, 2)", obj.ModeDecimal, ""},
+		{"2 * log(3)", obj.ModeDecimal, "expected operation supported in decimal mode, got 'log' at position 5"},
+		{"1 + 2", "binary", `unknown mode "binary", expected float or decimal`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			tree, err := ParseExpression(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckMode(tree, tt.mode)
+			if got := errorText(err); got != tt.err {
+				t.Errorf("CheckMode(%q, %s) = %q; want %q", tt.expression, tt.mode, got, tt.err)
+			}
+		})
+	}
+}
+
+// TestCheckDecimalPower tests that powers are rejected before they are computed if their exact result is too large
+func TestCheckDecimalPower(t *testing.T) {
+	tests := []struct {
+		base     string
+		exponent string
+		err      string
+	}{
+		{"2/3", "-2", ""},
+		{"10", "10000", ""},
+		{"1", "-10000", ""},
+		{"2", "1/2", "decimal mode supports only integer exponents"},
+		{"2", "10001", "exponent is too large for decimal mode"},
+		{"0", "-1", "division by zero"},
+		{"1/100000", "10000", "power is too large for decimal mode"},
+		{"10000000000", "10000", "power is too large for decimal mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base+"^"+tt.exponent, func(t *testing.T) {
+			base, _ := new(big.Rat).SetString(tt.base)
+			exponent, _ := new(big.Rat).SetString(tt.exponent)
+			if got := errorText(checkDecimalPower(base, exponent)); got != tt.err {
+				t.Errorf("checkDecimalPower(%s, %s) = %q; want %q", tt.base, tt.exponent, got, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		err  string
+	}{
+		{"0.1", "1/10", ""},
+		{"1e-3", "1/1000", ""},
+		{"2E+3", "2000", ""},
+		{"1/3", "1/3", ""},
+		{"1e10001", "", "exponent of 1e10001 is too large for decimal mode"},
+		{"1e-10001", "", "exponent of 1e-10001 is too large for decimal mode"},
+		{"1e99999999999999999999", "", "exponent of 1e99999999999999999999 is too large for decimal mode"},
+		{"one", "", "invalid number one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseDecimal(tt.text)
+			if errorText(err) != tt.err {
+				t.Fatalf("parseDecimal(%s) error = %v; want %q", tt.text, err, tt.err)
+			}
+			if err == nil && got.RatString() != tt.want {
+				t.Errorf("parseDecimal(%s) = %s; want %s", tt.text, got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleDecimal(t *testing.T) {
+	tree, err := ParseExpression("0.1 + 1e-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan string)
+	go func() {
+		result, _ := schedule(tree, obj.Task{ExpressionId: 4, Mode: obj.ModeDecimal}, nil)
+		done <- result.exact.RatString()
+	}()
+
+	task := dequeueTasks(t, 1)[0]
+	if task.Mode != obj.ModeDecimal || len(task.Args) != 0 || len(task.DecimalArgs) != 2 || task.DecimalArgs[0] != "1/10" || task.DecimalArgs[1] != "1/10" {
+		t.Errorf("unexpected task %+v", task)
+	}
+	ch := obj.Routes.Pop(task.Id).(*chan obj.TaskResult)
+	*ch <- obj.TaskResult{Id: task.Id, Decimal: "1/5"}
+
+	if result := <-done; result != "1/5" {
+		t.Errorf("schedule() = %s; want 1/5", result)
+	}
+}
+
+// errorText returns the text of err or an empty string if it is nil
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError is a syntax error found at Pos (byte offset) of the expression
+type ParseError struct {
+	Pos      int
+	Expected string
+	Got      string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("expected %s, got %s at position %d", e.Expected, e.Got, e.Pos+1)
+}
+
+// Caret returns the expression with a caret pointing to the error position below it
+func (e *ParseError) Caret(expression string) string {
+	pos := min(max(e.Pos, 0), len(expression))
+	return expression + "\n" + strings.Repeat(" ", utf8.RuneCountInString(expression[:pos])) + "^"
+}
+
+// ErrorMessage returns the text of err for the client, parse errors are followed by a caret pointing to the error
+func ErrorMessage(expression string, err error) string {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Error() + "\n" + parseErr.Caret(expression)
+	}
+	return err.Error()
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is a kind of lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// token is a lexical token of the expression, pos is its byte offset
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// String returns the token as it is shown in error messages
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return "'" + t.text + "'"
+}
+
+// isDigit reports whether c is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentStart reports whether c can start a function name
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// lex splits the expression into tokens, the last token is always tokenEOF
+func lex(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c) || c == '.':
+			end, err := scanNumber(expression, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[i:end], pos: i})
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(expression) && (isIdentStart(expression[end]) || isDigit(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expression[i:end], pos: i})
+			i = end
+		case c == '/' && i+1 < len(expression) && expression[i+1] == '/':
+			tokens = append(tokens, token{kind: tokenOperator, text: "//", pos: i})
+			i += 2
+		case c == '+' || c == '-' || c == '*' || c == '/' || c == '^' || c == '%':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c), pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		default:
+			r, _ := utf8.DecodeRuneInString(expression[i:])
+			if unicode.IsSpace(r) {
+				i += utf8.RuneLen(r)
+				continue
+			}
+			return nil, &ParseError{Pos: i, Expected: "number, operator or function", Got: fmt.Sprintf("'%c'", r)}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(expression)}), nil
+}
+
+// scanNumber reads a decimal literal such as 12, 3.14, .5 or 1e-3 starting at start
+// and returns the index of the first character after it
+func scanNumber(expression string, start int) (int, error) {
+	var digits, expDigits int
+	var dot, exp bool
+	i := start
+	for ; i < len(expression); i++ {
+		c := expression[i]
+		switch {
+		case isDigit(c):
+			if exp {
+				expDigits++
+			} else {
+				digits++
+			}
+			continue
+		case c == '.' && !dot && !exp:
+			dot = true
+			continue
+		case (c == 'e' || c == 'E') && !exp && digits > 0:
+			exp = true
+			if i+1 < len(expression) && (expression[i+1] == '+' || expression[i+1] == '-') {
+				i++
+			}
+			continue
+		case c == '.' || c == 'e' || c == 'E':
+			return i, &ParseError{Pos: i, Expected: "digit", Got: fmt.Sprintf("'%c'", c)}
+		}
+		break
+	}
+	if digits == 0 || (exp && expDigits == 0) {
+		got := "end of expression"
+		if i < len(expression) {
+			r, _ := utf8.DecodeRuneInString(expression[i:])
+			got = fmt.Sprintf("'%c'", r)
+		}
+		return i, &ParseError{Pos: i, Expected: "digit", Got: got}
+	}
+	return i, nil
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := lex("max(1.5, -2e3) // 4 ^ x_1")
+	if err != nil {
+		t.Fatalf("lex() error = %v", err)
+	}
+	want := []token{
+		{tokenIdent, "max", 0},
+		{tokenLParen, "(", 3},
+		{tokenNumber, "1.5", 4},
+		{tokenComma, ",", 7},
+		{tokenOperator, "-", 9},
+		{tokenNumber, "2e3", 10},
+		{tokenRParen, ")", 13},
+		{tokenOperator, "//", 15},
+		{tokenNumber, "4", 18},
+		{tokenOperator, "^", 20},
+		{tokenIdent, "x_1", 22},
+		{tokenEOF, "", 25},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("lex() = %v; want %v", tokens, want)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       ParseError
+	}{
+		{"1..2", ParseError{Pos: 2, Expected: "digit", Got: "'.'"}},
+		{"1 + 2e1.5", ParseError{Pos: 7, Expected: "digit", Got: "'.'"}},
+		{"4 * 2e", ParseError{Pos: 6, Expected: "digit", Got: "end of expression"}},
+		{"1 + .", ParseError{Pos: 5, Expected: "digit", Got: "end of expression"}},
+		{".e5", ParseError{Pos: 1, Expected: "digit", Got: "'e'"}},
+		{"2 & 3", ParseError{Pos: 2, Expected: "number, operator or function", Got: "'&'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := lex(tt.expression)
+			parseErr, ok := err.(*ParseError)
+			if !ok || *parseErr != tt.want {
+				t.Errorf("lex(%q) error = %v; want %v", tt.expression, err, &tt.want)
+			}
+		})
+	}
+}
@@ -1,229 +1,188 @@
 package parser
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	obj "orchestrator/internal/entities"
-	"os"
+	"pkg"
+	logger2 "pkg/logger"
 	"strconv"
+	"time"
 )
 
-// getEnvAsInt returns the value of the environment variable as an integer
-func getEnvAsInt(name string, defaultValue int) int {
-	valueStr := os.Getenv(name)
-	if valueStr == "" {
-		return defaultValue
-	}
-	value, err := strconv.Atoi(valueStr)
-	if err != nil {
-		return defaultValue
-	}
-	return value
-}
-
 // Time of operations in milliseconds
 var (
-	timeAdditionMs       = getEnvAsInt("TIME_ADDITION_MS", 100)
-	timeSubtractionMs    = getEnvAsInt("TIME_SUBTRACTION_MS", 100)
-	timeMultiplicationMs = getEnvAsInt("TIME_MULTIPLICATIONS_MS", 100)
-	timeDivisionMs       = getEnvAsInt("TIME_DIVISIONS_MS", 100)
+	timeAdditionMs       = pkg.GetEnvAsInt("TIME_ADDITION_MS", 100)
+	timeSubtractionMs    = pkg.GetEnvAsInt("TIME_SUBTRACTION_MS", 100)
+	timeMultiplicationMs = pkg.GetEnvAsInt("TIME_MULTIPLICATIONS_MS", 100)
+	timeDivisionMs       = pkg.GetEnvAsInt("TIME_DIVISIONS_MS", 100)
+	timePowerMs          = pkg.GetEnvAsInt("TIME_POWER_MS", 100)
+	timeModuloMs         = pkg.GetEnvAsInt("TIME_MODULO_MS", 100)
+	timeIntDivisionMs    = pkg.GetEnvAsInt("TIME_INT_DIVISION_MS", 100)
+	timeFunctionMs       = pkg.GetEnvAsInt("TIME_FUNCTIONS_MS", 100)
 )
 
-func returnTimeOfOperation(operation rune) int {
+func returnTimeOfOperation(operation string) int {
 	switch operation {
-	case '+':
+	case "+":
 		return timeAdditionMs
-	case '-':
+	case "-", unaryMinus:
 		return timeSubtractionMs
-	case '*':
+	case "*":
 		return timeMultiplicationMs
-	case '/':
+	case "/":
 		return timeDivisionMs
+	case "^":
+		return timePowerMs
+	case "%":
+		return timeModuloMs
+	case "//":
+		return timeIntDivisionMs
 	default:
+		if IsFunction(operation) {
+			return timeFunctionMs
+		}
 		return 100
 	}
 }
 
-// node is a struct that contains data and priority
-type node struct {
-	Data     string
-	Priority int
+// unaryMinus is the operator of the negation task
+const unaryMinus = "~"
+
+// arity is the allowed number of function arguments, max < 0 means unlimited
+type arity struct {
+	min, max int
 }
 
-// priority returns the priority of the operator
-func priority(c string) int {
-	switch c {
-	case "+", "-":
-		return 1
-	case "*", "/":
-		return 2
-	case "(", ")":
-		return 0
-	default:
-		if c >= "0" && c <= "9" {
-			return -1
-		} else {
-			return -2
-		}
-	}
+// allows reports whether the function can be called with argc arguments
+func (a arity) allows(argc int) bool {
+	return argc >= a.min && (a.max < 0 || argc <= a.max)
 }
 
-// getResult returns the result of the expression in Reverse Polish Notation
-func getResult(output string, ch *chan float64, Id int) (float64, error) {
-	var stack []node
-	var current string
-	var result float64
-	var tempVariable float64
-	for i := 0; i < len(output); i++ {
-		if output[i] != ' ' {
-			switch priority(string(output[i])) {
-			case -1:
-				current += string(output[i])
-			case 0:
-				return 0, errors.New("error '(' or ')' in output string")
-			case 1, 2:
-				if len(stack) < 2 {
-					return 0, errors.New("out of operands")
-				}
-				result, _ = strconv.ParseFloat(stack[len(stack)-1].Data, 64)
-				stack = append(stack[:len(stack)-1])
-				tempVariable, _ = strconv.ParseFloat(stack[len(stack)-1].Data, 64)
-				stack = append(stack[:len(stack)-1])
-				if result == 0 && output[i] == '/' {
-					return 0, errors.New("division by zero")
-				}
-				obj.Tasks.Enqueue(obj.Task{Id: Id, Arg1: tempVariable, Arg2: result, Operation: string(output[i]), OperationTime: returnTimeOfOperation(rune(output[i]))})
-				result = <-*ch
-				stack = append(stack, node{Data: strconv.FormatFloat(result, 'f', 2, 64)})
-				current = ""
-			default:
-				return 0, errors.New("wrong symbol")
-			}
-		} else {
-			if current != "" {
-				stack = append(stack, node{Data: current})
-				current = ""
-			}
-		}
+func (a arity) String() string {
+	if a.max < 0 {
+		return "at least " + plural(a.min, "argument")
 	}
-	if current != "" {
-		stack = append(stack, node{Data: current})
-		current = ""
+	return plural(a.max, "argument")
+}
+
+// plural returns the count followed by the word in the right form
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
 	}
-	if len(stack) > 1 {
-		return 0, errors.New("stack contains elements")
+	return strconv.Itoa(n) + " " + word + "s"
+}
+
+// functions contains built-in functions that can be called in expressions
+var functions = map[string]arity{
+	"sqrt": {1, 1},
+	"abs":  {1, 1},
+	"log":  {1, 1},
+	"sin":  {1, 1},
+	"cos":  {1, 1},
+	"min":  {1, -1},
+	"max":  {1, -1},
+}
+
+// IsFunction reports whether name is a built-in function
+func IsFunction(name string) bool {
+	_, ok := functions[name]
+	return ok
+}
+
+// checkDomain returns an error if the operation is not defined for the arguments
+func checkDomain(operation string, args []value) error {
+	switch operation {
+	case "+", "-", "*":
+		if args[0].exact != nil {
+			return checkDecimalSize(args[0].exact, args[1].exact)
+		}
+	case "/", "%", "//":
+		if args[1].sign() == 0 {
+			return errors.New("division by zero")
+		}
+		if args[0].exact != nil {
+			return checkDecimalSize(args[0].exact, args[1].exact)
+		}
+	case "sqrt":
+		if args[0].sign() < 0 {
+			return errors.New("square root of negative number")
+		}
+	case "log":
+		if args[0].sign() <= 0 {
+			return errors.New("logarithm of non-positive number")
+		}
+	case "^":
+		if args[1].exact != nil {
+			return checkDecimalPower(args[0].exact, args[1].exact)
+		}
 	}
-	result, _ = strconv.ParseFloat(stack[0].Data, 64)
-	return result, nil
+	return nil
+}
+
+// Parse the expression into the syntax tree, evaluates it in the mode and stores the result,
+// its tasks are computed before the other expressions of the user with lower priority
+func Parse(ctx context.Context, expr obj.Expression) {
+	Resume(ctx, expr, nil)
 }
 
-// Parse the expression into Reverse Polish Notation and returns the result
-func Parse(expression string, Id int, userId int) {
+// Resume evaluates the expression like Parse, but the operations computed before the restart are not dispatched again,
+// completed contains their results by step number
+func Resume(ctx context.Context, expr obj.Expression, completed map[int]obj.StepResult) {
 	defer obj.Wg.Done()
-	var stack []node
-	var output, current string
-	parserChan := make(chan float64)
+	logger := logger2.GetLogger(ctx)
+	started := time.Now()
 	t := obj.ClientResponse{
-		Id:     Id,
-		Status: "In progress",
+		Id:        expr.Id,
+		Status:    "In progress",
+		Mode:      expr.Mode,
+		StartedAt: &started,
 	}
-	t.SetUserId(userId)
-	obj.Expressions.Set(strconv.Itoa(Id), t)
-	fmt.Printf("Task with id(%d) and user_id(%d) has been added to the queue)", Id, userId)
-	obj.ParserMutex.Lock()
-	obj.ParsersTree.Insert(Id, &parserChan)
-	obj.ParserMutex.Unlock()
-	if expression == "" {
-		obj.ParserMutex.Lock()
-		_ = obj.ParsersTree.Delete(Id)
-		obj.ParserMutex.Unlock()
-		t.Id = Id
-		t.Status = "Fail"
-		t.Error = "empty expression"
-		t.SetUserId(userId)
-		obj.Expressions.Set(strconv.Itoa(Id), t)
-		fmt.Printf("Task with id(%d) failed with error %s", Id, "empty expression")
-		return
+	if !expr.CreatedAt.IsZero() {
+		t.CreatedAt = &expr.CreatedAt
 	}
-	for i := 0; i < len(expression); i++ {
-		switch priority(string(expression[i])) {
-		case -1:
-			current += string(expression[i])
-		case 0:
-			if current != "" {
-				output += current + " "
-				current = ""
-			}
-			if expression[i] == '(' {
-				stack = append(stack, node{Data: "(", Priority: 0})
-			} else {
-				for {
-					if len(stack) == 0 {
-						obj.ParserMutex.Lock()
-						_ = obj.ParsersTree.Delete(Id)
-						obj.ParserMutex.Unlock()
-						t.Id = Id
-						t.Status = "Fail"
-						t.Error = "'(' not found"
-						t.SetUserId(userId)
-						obj.Expressions.Set(strconv.Itoa(Id), t)
-					}
-					if stack[len(stack)-1].Data == "(" {
-						break
-					}
-					output += stack[len(stack)-1].Data + " "
-					stack = append(stack[:len(stack)-1])
-				}
-				stack = append(stack[:len(stack)-1])
-			}
-		case 1, 2:
-			if current != "" {
-				output += current + " "
-				current = ""
-			}
-			if len(stack) == 0 || stack[len(stack)-1].Priority < priority(string(expression[i])) {
-				stack = append(stack, node{Data: string(expression[i]), Priority: priority(string(expression[i]))})
-			} else {
-				for len(stack) != 0 && stack[len(stack)-1].Priority >= priority(string(expression[i])) {
-					output += stack[len(stack)-1].Data + " "
-					stack = append(stack[:len(stack)-1])
-				}
-				stack = append(stack, node{Data: string(expression[i]), Priority: priority(string(expression[i]))})
-			}
-		default:
-			obj.ParserMutex.Lock()
-			_ = obj.ParsersTree.Delete(Id)
-			obj.ParserMutex.Unlock()
-			t.Id = Id
-			t.Status = "Fail"
-			t.Error = "wrong symbol"
-			t.SetUserId(userId)
-			obj.Expressions.Set(strconv.Itoa(Id), t)
-		}
+	t.SetUserId(expr.UserId)
+	tree, err := ParseExpression(expr.Expression)
+	if err == nil {
+		err = CheckMode(tree, expr.Mode)
+		t.Operations = countOperations(tree)
 	}
-	if current != "" {
-		output += current + " "
-		current = ""
-	}
-	for len(stack) != 0 {
-		output += stack[len(stack)-1].Data + " "
-		stack = append(stack[:len(stack)-1])
+	setExpression(t)
+	logger.Info("Resume: expression was added to the queue:", "id", expr.Id, "user_id", expr.UserId)
+	if err != nil {
+		t.Error = ErrorMessage(expr.Expression, err)
+		finish(t, "Fail")
+		logger.Info("Resume: expression failed:", "id", expr.Id, "err", err)
+		return
 	}
-	result, err := getResult(output, &parserChan, Id)
-	obj.ParserMutex.Lock()
-	_ = obj.ParsersTree.Delete(Id)
-	obj.ParserMutex.Unlock()
+	result, err := schedule(tree, obj.Task{ExpressionId: expr.Id, Mode: expr.Mode, UserId: expr.UserId, Priority: expr.Priority}, completed)
 	if err != nil {
-		t.Id = Id
-		t.Status = "Fail"
 		t.Error = err.Error()
-		t.SetUserId(userId)
-		obj.Expressions.Set(strconv.Itoa(Id), t)
+		finish(t, "Fail")
 		return
 	}
-	t.Id = Id
-	t.Status = "Done"
-	t.Result = result
-	t.SetUserId(userId)
-	obj.Expressions.Set(strconv.Itoa(Id), t)
+	t.Result = result.float
+	if result.exact != nil {
+		t.Result, _ = result.exact.Float64()
+		t.Decimal = formatDecimal(result.exact)
+	}
+	finish(t, "Done")
+}
+
+// finish stores the final status of the expression and the time it was finished at
+func finish(t obj.ClientResponse, status string) {
+	finished := time.Now()
+	t.Status, t.FinishedAt = status, &finished
+	setExpression(t)
+}
+
+// setExpression stores the state of the expression and sends it to the clients following the expression,
+// finished expressions are put into the outbox to be written to DB
+func setExpression(t obj.ClientResponse) {
+	obj.Expressions.Set(strconv.Itoa(t.Id), t)
+	obj.Events.Publish(strconv.Itoa(t.Id), obj.ExpressionEvent{Name: obj.EventStatus, Data: t})
+	if t.Status != "In progress" {
+		obj.Outbox.Enqueue(t)
+	}
 }
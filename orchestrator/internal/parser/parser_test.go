@@ -1,129 +1,197 @@
 package parser
 
 import (
-	"errors"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"math/big"
+	obj "orchestrator/internal/entities"
+	logger2 "pkg/logger"
+	"strconv"
 	"testing"
+	"time"
 )
 
+// testCtx is the context of the expressions evaluated in tests, their logs are discarded
+var testCtx = logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
 func TestReturnTimeOfOperation(t *testing.T) {
 	tests := []struct {
-		operation rune
+		operation string
 		want      int
 	}{
-		{'+', timeAdditionMs},
-		{'-', timeSubtractionMs},
-		{'*', timeMultiplicationMs},
-		{'/', timeDivisionMs},
+		{"+", timeAdditionMs},
+		{"-", timeSubtractionMs},
+		{"*", timeMultiplicationMs},
+		{"/", timeDivisionMs},
+		{"~", timeSubtractionMs},
+		{"^", timePowerMs},
+		{"%", timeModuloMs},
+		{"//", timeIntDivisionMs},
+		{"sqrt", timeFunctionMs},
 	}
 
 	for _, tt := range tests {
-		t.Run(string(tt.operation), func(t *testing.T) {
+		t.Run(tt.operation, func(t *testing.T) {
 			got := returnTimeOfOperation(tt.operation)
 			if got != tt.want {
-				t.Errorf("returnTimeOfOperation(%c) = %d; want %d", tt.operation, got, tt.want)
+				t.Errorf("returnTimeOfOperation(%s) = %d; want %d", tt.operation, got, tt.want)
 			}
 		})
 	}
 }
 
-func TestPriority(t *testing.T) {
-	tests := []struct {
-		input string
-		want  int
-	}{
-		{"+", 1},
-		{"-", 1},
-		{"*", 2},
-		{"/", 2},
-		{"(", 0},
-		{")", 0},
-		{"1", -1},
-		{"a", -2},
+// runAgent executes tasks from the queue like an agent would and posts results to the parsers until ctx is done
+func runAgent(ctx context.Context) {
+	for ctx.Err() == nil {
+		task, ok := obj.Tasks.Dequeue().(obj.Task)
+		if !ok {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		ch := obj.Routes.Pop(task.Id).(*chan obj.TaskResult)
+		if task.Mode == obj.ModeDecimal {
+			*ch <- obj.TaskResult{Id: task.Id, Decimal: calculateDecimal(task)}
+			continue
+		}
+		var result float64
+		args := task.Args
+		switch task.Operation {
+		case "+":
+			result = args[0] + args[1]
+		case "-":
+			result = args[0] - args[1]
+		case "*":
+			result = args[0] * args[1]
+		case "/":
+			result = args[0] / args[1]
+		case "^":
+			result = math.Pow(args[0], args[1])
+		case "~":
+			result = -args[0]
+		case "sqrt":
+			result = math.Sqrt(args[0])
+		case "max":
+			result = args[0]
+			for _, arg := range args[1:] {
+				result = math.Max(result, arg)
+			}
+		}
+		*ch <- obj.TaskResult{Id: task.Id, Result: result}
 	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got := priority(tt.input)
-			if got != tt.want {
-				t.Errorf("priority(%s) = %d; want %d", tt.input, got, tt.want)
-			}
-		})
+// calculateDecimal computes the exact result of the task like an agent would
+func calculateDecimal(task obj.Task) string {
+	a, _ := new(big.Rat).SetString(task.DecimalArgs[0])
+	b, _ := new(big.Rat).SetString(task.DecimalArgs[len(task.DecimalArgs)-1])
+	switch task.Operation {
+	case "+":
+		return a.Add(a, b).RatString()
+	case "-":
+		return a.Sub(a, b).RatString()
+	case "*":
+		return a.Mul(a, b).RatString()
+	case "/":
+		return a.Quo(a, b).RatString()
+	case "^":
+		exponent := b.Num()
+		return a.SetFrac(new(big.Int).Exp(a.Num(), exponent, nil), new(big.Int).Exp(a.Denom(), exponent, nil)).RatString()
 	}
+	return ""
 }
 
-func TestGetResult(t *testing.T) {
+func TestParse(t *testing.T) {
 	tests := []struct {
-		name     string
-		output   string
-		ch       chan float64
-		Id       int
-		expected float64
-		err      error
+		name       string
+		expression string
+		mode       string
+		status     string
+		result     float64
+		decimal    string
+		err        string
 	}{
-		{
-			name:     "simple addition",
-			output:   "2 3 +",
-			ch:       make(chan float64, 1),
-			Id:       1,
-			expected: 5,
-			err:      nil,
-		},
-		{
-			name:     "division by zero",
-			output:   "2 0 /",
-			ch:       make(chan float64, 1),
-			Id:       2,
-			expected: 0,
-			err:      errors.New("division by zero"),
-		},
-		{
-			name:     "out of operands",
-			output:   "2 +",
-			ch:       make(chan float64, 1),
-			Id:       3,
-			expected: 0,
-			err:      errors.New("out of operands"),
-		},
-		{
-			name:     "wrong symbol",
-			output:   "2 3 &",
-			ch:       make(chan float64, 1),
-			Id:       4,
-			expected: 0,
-			err:      errors.New("wrong symbol"),
-		},
-		{
-			name:     "stack contains elements",
-			output:   "2 3 + 4",
-			ch:       make(chan float64, 1),
-			Id:       5,
-			expected: 0,
-			err:      errors.New("stack contains elements"),
-		},
-		{
-			name:     "error '(' or ')' in output string",
-			output:   "2 3 4 (",
-			ch:       make(chan float64, 1),
-			Id:       5,
-			expected: 0,
-			err:      errors.New("error '(' or ')' in output string"),
-		},
+		{"full precision of intermediate results", "1/3*3", obj.ModeFloat, "Done", 1, "", ""},
+		{"power binds tighter than unary minus", "-2 ^ 2", obj.ModeFloat, "Done", -4, "", ""},
+		{"function calls", "sqrt(16) + max(3, 7, 2)", obj.ModeFloat, "Done", 11, "", ""},
+		{"small numbers", "1e-3 * 2e-3", obj.ModeFloat, "Done", 2e-6, "", ""},
+		{"division by zero", "1 / (2 - 2)", obj.ModeFloat, "Fail", 0, "", "division by zero"},
+		{"syntax error", "2 * * 3", obj.ModeFloat, "Fail", 0, "", "expected operand, got '*' at position 5\n2 * * 3\n    ^"},
+		{"empty expression", "", obj.ModeFloat, "Fail", 0, "", "expected expression, got end of expression at position 1\n\n^"},
+		{"exact decimal", "0.1 + 0.2", obj.ModeDecimal, "Done", 0.3, "0.3", ""},
+		{"exact cents", "(19.99 - 0.01) * 3", obj.ModeDecimal, "Done", 59.94, "59.94", ""},
+		{"infinite decimal fraction", "2 / 3", obj.ModeDecimal, "Done", 2.0 / 3, "0.66666666666666666667", ""},
+		{"decimal division by zero", "1 / (0.1 - 0.1)", obj.ModeDecimal, "Fail", 0, "", "division by zero"},
+		{"fractional exponent in decimal mode", "2 ^ 0.5", obj.ModeDecimal, "Fail", 0, "", "decimal mode supports only integer exponents"},
+		{"too large power in decimal mode", "((10^10000)^10000)^10000", obj.ModeDecimal, "Fail", 0, "", "power is too large for decimal mode"},
+		{"too large product in decimal mode", "(2^10000)^13 * (2^10000)^13", obj.ModeDecimal, "Fail", 0, "", "result is too large for decimal mode"},
+		{"too small literal in decimal mode", "1e-100000000 + 1", obj.ModeDecimal, "Fail", 0, "", "exponent of 1e-100000000 is too large for decimal mode"},
+		{"inexact function in decimal mode", "1 + sqrt(4)", obj.ModeDecimal, "Fail", 0, "", "expected operation supported in decimal mode, got 'sqrt' at position 5\n1 + sqrt(4)\n    ^"},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if tt.err == nil || tt.name == "stack contains elements" {
-				tt.ch <- tt.expected
-			}
 
-			result, err := getResult(tt.output, &tt.ch, tt.Id)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runAgent(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
 
-			if err != nil && err.Error() != tt.err.Error() {
-				t.Errorf("expected error: %v, got: %v", tt.err, err)
-			}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := 1000 + i
+			obj.Wg.Add(1)
+			Parse(testCtx, obj.Expression{Id: id, UserId: 1, Expression: tt.expression, Mode: tt.mode})
 
-			if result != tt.expected {
-				t.Errorf("expected result: %v, got: %v", tt.expected, result)
+			got, ok := obj.Expressions.Get(strconv.Itoa(id)).(obj.ClientResponse)
+			if !ok {
+				t.Fatalf("expression %d is not stored", id)
+			}
+			if got.Status != tt.status || got.Result != tt.result || got.Decimal != tt.decimal || got.Error != tt.err {
+				t.Errorf("Parse(%q) = {%s %v %q %q}; want {%s %v %q %q}", tt.expression, got.Status, got.Result, got.Decimal, got.Error, tt.status, tt.result, tt.decimal, tt.err)
+			}
+			if got.StartedAt == nil || got.FinishedAt == nil || got.FinishedAt.Before(*got.StartedAt) {
+				t.Errorf("Parse(%q) started at %v, finished at %v", tt.expression, got.StartedAt, got.FinishedAt)
 			}
 		})
 	}
 }
+
+func TestParsePublishesEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runAgent(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	events, unsubscribe := obj.Events.Subscribe("1100")
+	defer unsubscribe()
+
+	obj.Wg.Add(1)
+	Parse(testCtx, obj.Expression{Id: 1100, UserId: 1, Expression: "0.1 + 0.2 * 2", Mode: obj.ModeDecimal})
+
+	var got []string
+	for len(got) < 4 {
+		event := (<-events).(obj.ExpressionEvent)
+		switch data := event.Data.(type) {
+		case obj.ClientResponse:
+			got = append(got, event.Name+" "+data.Status+" "+data.Decimal+" "+strconv.Itoa(data.Operations))
+		case obj.StepResult:
+			got = append(got, event.Name+" "+data.TaskId+" "+data.Operation+" "+data.Decimal)
+		}
+	}
+	want := []string{"status In progress  2", "step 1100.1 * 0.4", "step 1100.2 + 0.5", "status Done 0.5 2"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q; want %q", i, got[i], want[i])
+		}
+	}
+}
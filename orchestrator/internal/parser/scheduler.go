@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"fmt"
+	obj "orchestrator/internal/entities"
+	"strconv"
+)
+
+// step is an operation of the expression waiting for its arguments
+type step struct {
+	operation *Operation
+	args      []value
+	// pending is the number of arguments that are not computed yet
+	pending int
+	parent  *step
+	// index is the position of the step result in the parent arguments
+	index    int
+	children []*step
+	// number is the position of the step in post-order, it is the same every time the expression is parsed
+	number int
+}
+
+// newSteps builds steps for the operations of the tree and returns the root step,
+// result is set when the whole tree is a number, count is the number of steps built so far
+func newSteps(node Node, parent *step, index int, mode string, result *value, count *int) (*step, error) {
+	switch n := node.(type) {
+	case *Number:
+		v, err := numberValue(n, mode)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			*result = v
+		} else {
+			parent.args[index] = v
+		}
+		return nil, nil
+	case *Operation:
+		s := &step{operation: n, args: make([]value, len(n.Args)), parent: parent, index: index}
+		for i, arg := range n.Args {
+			child, err := newSteps(arg, s, i, mode, result, count)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				s.pending++
+				s.children = append(s.children, child)
+			}
+		}
+		*count++
+		s.number = *count
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unexpected node %T", node)
+	}
+}
+
+// readySteps returns the steps whose arguments are all known
+func readySteps(s *step, ready []*step) []*step {
+	if s.pending == 0 {
+		return append(ready, s)
+	}
+	for _, child := range s.children {
+		ready = readySteps(child, ready)
+	}
+	return ready
+}
+
+// countOperations returns the number of tasks needed to evaluate the tree
+func countOperations(node Node) int {
+	op, ok := node.(*Operation)
+	if !ok {
+		return 0
+	}
+	count := 1
+	for _, arg := range op.Args {
+		count += countOperations(arg)
+	}
+	return count
+}
+
+// scheduler dispatches the steps of one expression and joins their results by task id
+type scheduler struct {
+	// expression is the template of the tasks with the fields shared by all operations of the expression
+	expression obj.Task
+	results    *chan obj.TaskResult
+	// inFlight contains dispatched steps by their task ids
+	inFlight map[string]*step
+}
+
+// dispatch checks the arguments of the step and sends it to agents
+func (sc *scheduler) dispatch(s *step) error {
+	if err := checkDomain(s.operation.Operator, s.args); err != nil {
+		return err
+	}
+	task := sc.expression
+	task.Id = obj.TaskId(task.ExpressionId, s.number)
+	task.Operation = s.operation.Operator
+	task.OperationTime = returnTimeOfOperation(s.operation.Operator)
+	for _, arg := range s.args {
+		if arg.exact != nil {
+			task.DecimalArgs = append(task.DecimalArgs, arg.exact.RatString())
+		} else {
+			task.Args = append(task.Args, arg.float)
+		}
+	}
+	sc.inFlight[task.Id] = s
+	obj.Routes.Set(task.Id, sc.results)
+	obj.Tasks.Enqueue(task)
+	return nil
+}
+
+// resultValue returns the value computed by the task
+func (sc *scheduler) resultValue(result obj.TaskResult) (value, error) {
+	if sc.expression.Mode != obj.ModeDecimal {
+		return value{float: result.Result}, nil
+	}
+	exact, err := parseDecimal(result.Decimal)
+	if err != nil {
+		return value{}, fmt.Errorf("task %s returned invalid decimal %q", result.Id, result.Decimal)
+	}
+	return value{exact: exact}, nil
+}
+
+// publish sends the result of the step to the clients following the expression and puts it into the outbox,
+// so the step is not computed again if the orchestrator restarts
+func (sc *scheduler) publish(s *step, taskId string, v value) {
+	step := obj.StepResult{
+		TaskId:       taskId,
+		Operation:    s.operation.Operator,
+		Result:       v.float,
+		Mode:         sc.expression.Mode,
+		ExpressionId: sc.expression.ExpressionId,
+		Step:         s.number,
+	}
+	for _, arg := range s.args {
+		if arg.exact != nil {
+			step.Args = append(step.Args, arg.exact.RatString())
+		} else {
+			step.Args = append(step.Args, strconv.FormatFloat(arg.float, 'g', -1, 64))
+		}
+	}
+	if v.exact != nil {
+		step.Result, _ = v.exact.Float64()
+		step.Decimal = formatDecimal(v.exact)
+		step.Exact = v.exact.RatString()
+	}
+	obj.Events.Publish(strconv.Itoa(sc.expression.ExpressionId), obj.ExpressionEvent{Name: obj.EventStep, Data: step})
+	obj.Outbox.Enqueue(step)
+}
+
+// restore applies the results of the steps computed before the restart, the value is returned if the step itself is computed.
+// Computed steps are removed from the tree so they are not dispatched
+func (sc *scheduler) restore(s *step, completed map[int]obj.StepResult) (value, bool, error) {
+	if result, ok := completed[s.number]; ok {
+		v, err := sc.resultValue(obj.TaskResult{Id: result.TaskId, Result: result.Result, Decimal: result.Exact})
+		return v, err == nil, err
+	}
+	children := s.children[:0]
+	for _, child := range s.children {
+		v, computed, err := sc.restore(child, completed)
+		if err != nil {
+			return value{}, false, err
+		}
+		if computed {
+			s.args[child.index] = v
+			s.pending--
+		} else {
+			children = append(children, child)
+		}
+	}
+	s.children = children
+	return value{}, false, nil
+}
+
+// release stops waiting for the tasks that are still in flight
+func (sc *scheduler) release() {
+	for id := range sc.inFlight {
+		obj.Routes.Delete(id)
+	}
+}
+
+// schedule evaluates the tree: every operation whose arguments are known is dispatched at once,
+// so independent subtrees are computed by agents concurrently. The tasks are copies of the expression
+// task with its id, mode, user and priority. Steps in completed are not dispatched, their results are used
+func schedule(tree Node, expression obj.Task, completed map[int]obj.StepResult) (value, error) {
+	var result value
+	var count int
+	root, err := newSteps(tree, nil, 0, expression.Mode, &result, &count)
+	if err != nil || root == nil {
+		return result, err
+	}
+	// results is buffered for every task so agents never block on an expression that has failed
+	results := make(chan obj.TaskResult, countOperations(tree))
+	sc := &scheduler{expression: expression, results: &results, inFlight: make(map[string]*step)}
+	defer sc.release()
+	if v, computed, err := sc.restore(root, completed); err != nil || computed {
+		return v, err
+	}
+	for _, s := range readySteps(root, nil) {
+		if err = sc.dispatch(s); err != nil {
+			return value{}, err
+		}
+	}
+	for taskResult := range results {
+		s, ok := sc.inFlight[taskResult.Id]
+		if !ok {
+			continue
+		}
+		delete(sc.inFlight, taskResult.Id)
+		if taskResult.Err != nil {
+			return value{}, taskResult.Err
+		}
+		v, err := sc.resultValue(taskResult)
+		if err != nil {
+			return value{}, err
+		}
+		sc.publish(s, taskResult.Id, v)
+		if s.parent == nil {
+			return v, nil
+		}
+		s.parent.args[s.index] = v
+		s.parent.pending--
+		if s.parent.pending == 0 {
+			if err = sc.dispatch(s.parent); err != nil {
+				return value{}, err
+			}
+		}
+	}
+	return value{}, fmt.Errorf("expression %d: results channel closed", expression.ExpressionId)
+}
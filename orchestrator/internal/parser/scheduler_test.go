@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"errors"
+	obj "orchestrator/internal/entities"
+	"testing"
+	"time"
+)
+
+// dequeueTasks waits for n tasks to appear in the queue
+func dequeueTasks(t *testing.T, n int) []obj.Task {
+	var tasks []obj.Task
+	deadline := time.After(time.Second)
+	for len(tasks) < n {
+		select {
+		case <-deadline:
+			t.Fatalf("got %d tasks in the queue; want %d", len(tasks), n)
+		default:
+		}
+		if task, ok := obj.Tasks.Dequeue().(obj.Task); ok {
+			tasks = append(tasks, task)
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return tasks
+}
+
+// postResult delivers the result of the task to the waiting scheduler
+func postResult(task obj.Task, result float64) {
+	ch := obj.Routes.Pop(task.Id).(*chan obj.TaskResult)
+	*ch <- obj.TaskResult{Id: task.Id, Result: result}
+}
+
+func TestScheduleDispatchesIndependentOperationsConcurrently(t *testing.T) {
+	tree, err := ParseExpression("(1 + 2) * (3 + 4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan float64)
+	go func() {
+		result, _ := schedule(tree, obj.Task{ExpressionId: 1, Mode: obj.ModeFloat}, nil)
+		done <- result.float
+	}()
+
+	// both additions are in the queue before any of them is computed
+	tasks := dequeueTasks(t, 2)
+	if ids := map[string]bool{tasks[0].Id: true, tasks[1].Id: true}; !ids["1.1"] || !ids["1.2"] {
+		t.Errorf("got task ids %s and %s; want 1.1 and 1.2", tasks[0].Id, tasks[1].Id)
+	}
+	for _, task := range tasks {
+		if task.Operation != "+" || task.ExpressionId != 1 {
+			t.Errorf("unexpected task %+v", task)
+		}
+	}
+	// results are joined by task id regardless of the order they arrive in
+	postResult(tasks[1], tasks[1].Args[0]+tasks[1].Args[1])
+	postResult(tasks[0], tasks[0].Args[0]+tasks[0].Args[1])
+
+	multiplication := dequeueTasks(t, 1)[0]
+	if multiplication.Id != "1.3" || multiplication.Operation != "*" || multiplication.Args[0] != 3 || multiplication.Args[1] != 7 {
+		t.Errorf("unexpected task %+v", multiplication)
+	}
+	postResult(multiplication, 21)
+
+	if result := <-done; result != 21 {
+		t.Errorf("schedule() = %v; want 21", result)
+	}
+}
+
+func TestScheduleNumber(t *testing.T) {
+	tree, err := ParseExpression("(42)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := schedule(tree, obj.Task{ExpressionId: 2, Mode: obj.ModeFloat}, nil); err != nil || result.float != 42 {
+		t.Errorf("schedule() = %v, %v; want 42, nil", result.float, err)
+	}
+}
+
+func TestScheduleFailedTask(t *testing.T) {
+	tree, err := ParseExpression("(1 + 2) * 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := schedule(tree, obj.Task{ExpressionId: 3, Mode: obj.ModeFloat}, nil)
+		done <- err
+	}()
+
+	task := dequeueTasks(t, 1)[0]
+	ch := obj.Routes.Pop(task.Id).(*chan obj.TaskResult)
+	*ch <- obj.TaskResult{Id: task.Id, Err: errors.New("operation + was not completed by agents after 3 attempts")}
+
+	if err := <-done; err == nil || err.Error() != "operation + was not completed by agents after 3 attempts" {
+		t.Errorf("schedule() error = %v; want the error of the task", err)
+	}
+	if !obj.Tasks.IsEmpty() {
+		t.Error("tasks were dispatched after the expression failed")
+	}
+}
+
+func TestScheduleTasksOfUser(t *testing.T) {
+	tree, err := ParseExpression("1 + 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan float64)
+	go func() {
+		result, _ := schedule(tree, obj.Task{ExpressionId: 5, Mode: obj.ModeFloat, UserId: 7, Priority: 3}, nil)
+		done <- result.float
+	}()
+
+	// tasks are queued among the tasks of the user by the priority of the expression
+	task := dequeueTasks(t, 1)[0]
+	if task.UserId != 7 || task.Priority != 3 || task.Mode != obj.ModeFloat || task.Id != "5.1" {
+		t.Errorf("unexpected task %+v", task)
+	}
+	postResult(task, 3)
+	if result := <-done; result != 3 {
+		t.Errorf("schedule() = %v; want 3", result)
+	}
+}
+
+func TestScheduleRestoresCompletedSteps(t *testing.T) {
+	tree, err := ParseExpression("(1 + 2) * (3 + 4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan float64)
+	go func() {
+		completed := map[int]obj.StepResult{1: {TaskId: "6.1", Result: 3}}
+		result, _ := schedule(tree, obj.Task{ExpressionId: 6, Mode: obj.ModeFloat}, completed)
+		done <- result.float
+	}()
+
+	// only the operations that were not computed before the restart are dispatched
+	addition := dequeueTasks(t, 1)[0]
+	if addition.Id != "6.2" || addition.Args[0] != 3 || addition.Args[1] != 4 {
+		t.Errorf("unexpected task %+v", addition)
+	}
+	postResult(addition, 7)
+
+	multiplication := dequeueTasks(t, 1)[0]
+	if multiplication.Id != "6.3" || multiplication.Args[0] != 3 || multiplication.Args[1] != 7 {
+		t.Errorf("unexpected task %+v", multiplication)
+	}
+	postResult(multiplication, 21)
+	if result := <-done; result != 21 {
+		t.Errorf("schedule() = %v; want 21", result)
+	}
+
+	// the results of the computed steps are written to DB
+	var steps []int
+	for element := obj.Outbox.Dequeue(); element != nil; element = obj.Outbox.Dequeue() {
+		if step, ok := element.(obj.StepResult); ok && step.ExpressionId == 6 {
+			steps = append(steps, step.Step)
+		}
+	}
+	if len(steps) != 2 || steps[0] != 2 || steps[1] != 3 {
+		t.Errorf("got steps %v in the outbox; want [2 3]", steps)
+	}
+}
+
+func TestScheduleRestoresComputedExpression(t *testing.T) {
+	tree, err := ParseExpression("2 * 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := map[int]obj.StepResult{1: {TaskId: "7.1", Exact: "6"}}
+	result, err := schedule(tree, obj.Task{ExpressionId: 7, Mode: obj.ModeDecimal}, completed)
+	if err != nil || result.exact == nil || result.exact.RatString() != "6" {
+		t.Errorf("schedule() = %v, %v; want 6, nil", result.exact, err)
+	}
+	if !obj.Tasks.IsEmpty() {
+		t.Error("tasks were dispatched for the computed expression")
+	}
+}
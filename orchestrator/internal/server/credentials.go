@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// minPasswordLength is the least number of characters in a password
+	minPasswordLength = 8
+	// maxPasswordLength is the largest password in bytes, bcrypt ignores the bytes after it
+	maxPasswordLength = 72
+	// passwordCost is the bcrypt cost of new hashes, hashes with a lower cost are replaced on login
+	passwordCost = bcrypt.DefaultCost
+)
+
+// loginPattern is the format of logins: 3 to 32 latin letters, digits, dots, dashes and underscores
+var loginPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// validateCredentials returns an error describing why the login or the password can't be registered
+func validateCredentials(login string, password string) error {
+	if !loginPattern.MatchString(login) {
+		return errors.New("login must be 3 to 32 latin letters, digits, dots, dashes or underscores")
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes long", maxPasswordLength)
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", fmt.Errorf("hashPassword: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether the password matches the stored one and whether the stored one has to be rehashed:
+// users registered before passwords were hashed have plaintext passwords, they are hashed on the next login
+func checkPassword(stored string, password string) (ok bool, rehash bool) {
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	ok = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	return ok, ok && cost < passwordCost
+}
+
+// dummyHash is compared with passwords of unknown logins, so they take as long to check as passwords of existing users
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("dummy password")
+	return hash
+})
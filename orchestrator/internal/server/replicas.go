@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"orchestrator/internal/storage"
+	"os"
+	"pkg"
+	logger2 "pkg/logger"
+	"time"
+)
+
+var (
+	// replicaHeartbeatIntervalMs is how often the replica extends the ownership of its expressions and
+	// looks for expressions of stopped replicas
+	replicaHeartbeatIntervalMs = pkg.GetEnvAsInt("REPLICA_HEARTBEAT_INTERVAL_MS", 5000)
+	// replicaTimeoutMs is the time without heartbeats after which the expressions of a replica are claimed by others
+	replicaTimeoutMs = pkg.GetEnvAsInt("REPLICA_TIMEOUT_MS", 15000)
+)
+
+// replicaId is the owner of the expressions created and claimed by this process,
+// a restarted process is another owner, so it claims the expressions of its previous run after replicaTimeoutMs
+var replicaId = newReplicaId()
+
+// newReplicaId returns the host name with a random suffix
+func newReplicaId() string {
+	host, _ := os.Hostname()
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+	return host + "-" + hex.EncodeToString(random)
+}
+
+// expiredBefore returns the time of the last heartbeat of replicas considered stopped
+func expiredBefore(now time.Time) time.Time {
+	return now.Add(-time.Duration(replicaTimeoutMs) * time.Millisecond)
+}
+
+// keepOwnership sends heartbeats for the expressions of the replica and resumes the expressions of stopped replicas
+// until the context is done
+func keepOwnership(ctx context.Context, repo storage.Repository) {
+	logger := logger2.GetLogger(ctx)
+	ticker := time.NewTicker(time.Duration(replicaHeartbeatIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := repo.Heartbeat(ctx, replicaId, now); err != nil {
+				logger.Error("keepOwnership: could not send heartbeat:", "err", err)
+			}
+			_ = syncDBWithCache(ctx, repo)
+		}
+	}
+}
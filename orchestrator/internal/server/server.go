@@ -2,101 +2,195 @@ package server
 
 import (
 	"context"
-	"database/sql"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	obj "orchestrator/internal/entities"
 	"orchestrator/internal/parser"
+	"orchestrator/internal/storage"
+	"os"
+	"pkg"
 	logger2 "pkg/logger"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	UpdateExpressionStatus = "UPDATE expressions SET user_id= $1, result = $2, status = $3 WHERE id = $4"
-	secretKey              = "secret"
-)
-
-// syncDBWithCache starts synchronization DB with cache
-func syncDBWithCache(ctx context.Context, db *sql.DB) error {
+// syncDBWithCache starts synchronization DB with cache: the unfinished expressions without a running owner are claimed
+// by the replica and resumed, the steps computed before the restart are not computed again
+func syncDBWithCache(ctx context.Context, repo storage.Repository) error {
 	logger := logger2.GetLogger(ctx)
-	rows, err := db.QueryContext(ctx, "SELECT id, user_id, expression FROM expressions WHERE status = $1", "In progress")
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	expressions, err := repo.Unfinished(ctx, replicaId, expiredBefore(time.Now()))
+	if err != nil {
 		logger.Error("Error in syncDBWithCache: ", "err", err)
 		return fmt.Errorf("syncDBWithCache: %w", err)
 	}
-	defer func(rows *sql.Rows) {
-		err = rows.Close()
-		if err != nil {
-			logger.Error("syncDBWithCache: closing rows: ", "err", err)
-		}
-	}(rows)
-	if rows != nil {
-		for rows.Next() {
-			var expr string
-			var userId int
-			var id int
-			err = rows.Scan(&id, &userId, &expr)
-			if err != nil {
-				logger.Error("Error in syncDBWithCache: ", "err", err.Error())
-				return fmt.Errorf("syncDBWithCache: %w", err)
-			}
-			obj.Wg.Add(1)
-			go parser.Parse(expr, id, userId)
-		}
+	if len(expressions) == 0 {
+		return nil
+	}
+	steps, err := repo.CompletedSteps(ctx)
+	if err != nil {
+		logger.Error("Error in syncDBWithCache: ", "err", err)
+		return fmt.Errorf("syncDBWithCache: %w", err)
+	}
+	for _, expr := range expressions {
+		obj.Wg.Add(1)
+		go parser.Resume(ctx, expr, steps[expr.Id])
 	}
 	return nil
 }
 
-// startUpdatingDB updates DB with expressions in map and deletes old expressions
-func startUpdatingDB(ctx context.Context, db *sql.DB) {
-	ticker := time.NewTicker(15 * time.Second)
+const (
+	// maxBatch is the largest number of expressions and steps written to DB in one transaction
+	maxBatch = 100
+	// minBackoff and maxBackoff bound the pause before a failed write is retried
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+var (
+	// maxWriteAttempts is the number of failed writes after which an element is parked,
+	// only writes failed while other elements were written are counted
+	maxWriteAttempts = pkg.GetEnvAsInt("WRITE_MAX_ATTEMPTS", 5)
+	// maxOutbox is the size of obj.Outbox after which new expressions are rejected until it is written
+	maxOutbox = pkg.GetEnvAsInt("OUTBOX_MAX_SIZE", 10000)
+)
+
+// outboxElement is an expression or a step waiting to be written with the number of its failed writes
+type outboxElement struct {
+	element  interface{}
+	failures int
+	err      error
+}
+
+// persistExpressions writes finished expressions and computed steps from obj.Outbox to DB as soon as they are computed.
+// If a batch fails, its elements are written one at a time: the written ones are done, if none was written DB is
+// considered unavailable and the rest is retried with exponential backoff, so no result is lost on DB errors.
+// An element that fails maxWriteAttempts times while others are written is parked: the error is logged and
+// the expression stays in the cache, so it doesn't block the outbox
+func persistExpressions(ctx context.Context, repo storage.Repository) {
 	logger := logger2.GetLogger(ctx)
-	go func() {
-		for range ticker.C {
-			expressionsMap := obj.Expressions.GetAll()
-			for key, expr := range expressionsMap {
-				task, ok := expr.(obj.ClientResponse)
-				if ok && (task.Status == "Done" || task.Status == "Fail") {
-					_, err := db.ExecContext(ctx, UpdateExpressionStatus, task.GetUserId(), task.Result, task.Status, task.Id)
-					if err != nil {
-						logger.Error("Error updating expressions: ", "err", err)
-						return
-					}
-					obj.Expressions.Delete(key)
+	backoff := minBackoff
+	var batch []outboxElement
+	for {
+		if len(batch) == 0 {
+			element, err := obj.Outbox.DequeueWait(ctx)
+			if err != nil {
+				return
+			}
+			batch = append(batch, outboxElement{element: element})
+		}
+		for len(batch) < maxBatch {
+			element := obj.Outbox.Dequeue()
+			if element == nil {
+				break
+			}
+			batch = append(batch, outboxElement{element: element})
+		}
+		elements := make([]interface{}, len(batch))
+		for i, e := range batch {
+			elements[i] = e.element
+		}
+		err := repo.Write(ctx, elements)
+		if err == nil {
+			written(batch)
+			batch, backoff = nil, minBackoff
+			continue
+		}
+
+		var failed, done []outboxElement
+		if len(batch) == 1 {
+			batch[0].err = err
+			failed = batch
+		} else {
+			logger.Error("persistExpressions: could not write expressions, writing them one at a time:", "err", err)
+			for _, e := range batch {
+				if e.err = repo.Write(ctx, []interface{}{e.element}); e.err != nil {
+					failed = append(failed, e)
+					continue
 				}
+				done = append(done, e)
+			}
+		}
+		written(done)
+		if len(done) == 0 {
+			logger.Error("persistExpressions: could not write expressions, retrying:", "err", failed[0].err, "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
 			}
+			backoff = min(backoff*2, maxBackoff)
+			batch = failed
+			continue
 		}
-	}()
+
+		batch, backoff = nil, minBackoff
+		for _, e := range failed {
+			e.failures++
+			if e.failures >= maxWriteAttempts {
+				logger.Error("persistExpressions: could not write element, parking it:",
+					"element", e.element, "attempts", e.failures, "err", e.err)
+				continue
+			}
+			batch = append(batch, e)
+		}
+	}
 }
 
-// isValidExpression checks if the expression is valid
-func isValidExpression(expression string) bool {
-	re := regexp.MustCompile("^[\\d+\\-*/\\s()]+$")
-	return re.MatchString(expression)
+// written removes the written expressions from the cache
+func written(batch []outboxElement) {
+	for _, e := range batch {
+		if expr, ok := e.element.(obj.ClientResponse); ok {
+			obj.Expressions.Delete(strconv.Itoa(expr.Id))
+		}
+	}
 }
 
+// maxRequestBytes is the largest body of /api/v1/calculate, it fits the longest expression escaped in JSON
+const maxRequestBytes = 8 * parser.MaxExpressionLength
+
 // calculateHandler handles the /api/v1/calculate endpoint
-func calculateHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
+func calculateHandler(ctx context.Context, repo storage.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logger2.GetLogger(ctx)
 		var clientRequest obj.ClientRequest
 		var clientResponse obj.ClientResponse
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 		err := json.NewDecoder(r.Body).Decode(&clientRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		if err != nil {
 			clientResponse.Error = "Internal server error"
 			w.WriteHeader(http.StatusInternalServerError)
 			logger.Error("calculateHandler: could not decode request:", "err", err)
 			return
 		}
-		if !isValidExpression(clientRequest.Expression) {
-			clientResponse.Error = "Expression is not valid"
+		if obj.Outbox.Len() >= maxOutbox {
+			// DB doesn't keep up with the results, they are kept in memory until written
+			logger.Warn("calculateHandler: outbox is full:", "size", obj.Outbox.Len())
+			http.Error(w, "Service unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if clientRequest.Mode == "" {
+			clientRequest.Mode = obj.ModeFloat
+		}
+		tree, err := parser.ParseExpression(clientRequest.Expression)
+		if err == nil {
+			err = parser.CheckMode(tree, clientRequest.Mode)
+		}
+		if err != nil {
+			clientResponse.Error = parser.ErrorMessage(clientRequest.Expression, err)
+			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnprocessableEntity)
+			if err = json.NewEncoder(w).Encode(clientResponse); err != nil {
+				logger.Error("calculateHandler: could not encode response:", "err", err)
+			}
 			return
 		}
 		userId, ok := r.Context().Value("user_id").(int)
@@ -105,14 +199,22 @@ func calculateHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		row := db.QueryRowContext(ctx, "INSERT INTO expressions(user_id, expression, status) VALUES(?, ?, ?) RETURNING id", userId, clientRequest.Expression, "In progress")
-		err = row.Scan(&clientResponse.Id)
+		expr := obj.Expression{
+			UserId:     userId,
+			Expression: clientRequest.Expression,
+			Mode:       clientRequest.Mode,
+			Priority:   clientRequest.Priority,
+			CreatedAt:  time.Now(),
+			Owner:      replicaId,
+		}
+		clientResponse.Id, err = repo.CreateExpression(ctx, expr)
 		if err != nil {
 			logger.Warn("calculateHandler: could not insert expressions: ", "err", err)
 			return
 		}
 		obj.Wg.Add(1)
-		go parser.Parse(clientRequest.Expression, clientResponse.Id, userId)
+		expr.Id = clientResponse.Id
+		go parser.Parse(ctx, expr)
 
 		logger.Info("calculateHandler: expression was added to the queue:", "Id", clientResponse.Id)
 		w.WriteHeader(http.StatusCreated)
@@ -126,7 +228,7 @@ func calculateHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 }
 
 // expressionHandler handles the /api/v1/expressions endpoint
-func expressionHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
+func expressionHandler(ctx context.Context, repo storage.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logger2.GetLogger(ctx)
 		userID, ok := r.Context().Value("user_id").(int)
@@ -135,42 +237,17 @@ func expressionHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		rows, err := db.QueryContext(ctx, `
-            SELECT id, status, result 
-            FROM expressions 
-            WHERE user_id = ?`,
-			userID,
-		)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		expressions, err := repo.Expressions(ctx, userID)
+		if err != nil {
 			logger.Error("database query error", "error", err)
 			http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
 			return
 		}
-		defer func(rows *sql.Rows) {
-			err := rows.Close()
-			if err != nil {
-				logger.Error("database close error", "error", err)
-				return
+		for i, expr := range expressions {
+			// the cache is ahead of DB until the expression is flushed
+			if cached, ok := cachedExpression(userID, expr.Id); ok {
+				expressions[i] = cached
 			}
-		}(rows)
-
-		var expressions []obj.ClientResponse
-		for rows.Next() {
-			var expr obj.ClientResponse
-
-			_ = rows.Scan(
-				&expr.Id,
-				&expr.Status,
-				&expr.Result,
-			)
-
-			expressions = append(expressions, expr)
-		}
-
-		if err = rows.Err(); err != nil {
-			logger.Error("rows iteration error", "error", err)
-			http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
-			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -187,7 +264,7 @@ func expressionHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 }
 
 // expressionIDHandler handles the /api/v1/expressions/{id} endpoint
-func expressionIDHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
+func expressionIDHandler(ctx context.Context, repo storage.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logger2.GetLogger(ctx)
 		userID, ok := r.Context().Value("user_id").(int)
@@ -203,15 +280,8 @@ func expressionIDHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid ID", http.StatusInternalServerError)
 			return
 		}
-		var expr obj.ClientResponse
-		row := db.QueryRow(`
-            SELECT result, status 
-            FROM expressions 
-            WHERE user_id = ? and id = ?`,
-			userID, id,
-		)
-		err = row.Scan(&expr.Result, &expr.Status)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		expr, err := currentExpression(ctx, repo, userID, id)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
 			logger.Error("database query error", "error", err)
 			return
 		}
@@ -226,8 +296,123 @@ func expressionIDHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// authMiddleware checks auth status of user by jwt token
-func authMiddleware(ctx context.Context) func(http.HandlerFunc) http.HandlerFunc {
+// cachedExpression returns the expression of the user if it is in the cache
+func cachedExpression(userID int, id int) (obj.ClientResponse, bool) {
+	expr, ok := obj.Expressions.Get(strconv.Itoa(id)).(obj.ClientResponse)
+	if !ok || expr.GetUserId() != userID {
+		return obj.ClientResponse{}, false
+	}
+	return expr, true
+}
+
+// currentExpression returns the expression of the user from the cache or from DB if it is already stored there
+func currentExpression(ctx context.Context, repo storage.Repository, userID int, id int) (obj.ClientResponse, error) {
+	if expr, ok := cachedExpression(userID, id); ok {
+		return expr, nil
+	}
+	return repo.Expression(ctx, userID, id)
+}
+
+// writeEvent sends the event to the client of the event stream
+func writeEvent(w http.ResponseWriter, event obj.ExpressionEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, data); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// finished reports whether the status is final, no events follow it
+func finished(status string) bool {
+	return status == "Done" || status == "Fail"
+}
+
+// expressionEventsHandler handles the /api/v1/expressions/{id}/events endpoint, it streams server-sent events
+// with the status of the expression and the results of its operations until the expression is finished
+func expressionEventsHandler(ctx context.Context, repo storage.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logger2.GetLogger(ctx)
+		userID, ok := r.Context().Value("user_id").(int)
+		if !ok {
+			logger.Warn("expressionEventsHandler: could not get user_id from context")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		if _, ok = w.(http.Flusher); !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		// the client subscribes before reading the state, so it doesn't miss the changes made in between
+		events, unsubscribe := obj.Events.Subscribe(strconv.Itoa(id))
+		defer func() { unsubscribe() }()
+		expr, err := currentExpression(ctx, repo, userID, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Expression not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("expressionEventsHandler: database query error", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		// send returns false once the stream is over
+		send := func(event obj.ExpressionEvent) bool {
+			if err := writeEvent(w, event); err != nil {
+				logger.Error("expressionEventsHandler: could not send event:", "err", err)
+				return false
+			}
+			status, ok := event.Data.(obj.ClientResponse)
+			return !ok || !finished(status.Status)
+		}
+		if !send(obj.ExpressionEvent{Name: obj.EventStatus, Data: expr}) {
+			return
+		}
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+			case message, ok := <-events:
+				if !ok {
+					// the client lagged behind and lost events, it gets the current state instead
+					events, unsubscribe = obj.Events.Subscribe(strconv.Itoa(id))
+					if expr, err = currentExpression(ctx, repo, userID, id); err != nil {
+						logger.Error("expressionEventsHandler: could not get expression:", "err", err)
+						return
+					}
+					message = obj.ExpressionEvent{Name: obj.EventStatus, Data: expr}
+				}
+				if !send(message.(obj.ExpressionEvent)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// authMiddleware checks auth status of user by jwt token signed with one of the keys
+func authMiddleware(ctx context.Context, keys *Keys) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 
@@ -244,32 +429,59 @@ func authMiddleware(ctx context.Context) func(http.HandlerFunc) http.HandlerFunc
 			}
 			tokenStr := tokenParts[1]
 
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(secretKey), nil
-			})
-
-			if err != nil || !token.Valid {
+			userID, err := parseToken(tokenStr, keys)
+			if err != nil {
 				sendJSONError(w, "Invalid token", http.StatusUnauthorized, ctx)
 				return
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				sendJSONError(w, "Invalid token claims", http.StatusUnauthorized, ctx)
+			if userID == 0 {
+				sendJSONError(w, "Invalid user ID", http.StatusUnauthorized, ctx)
 				return
 			}
 
-			userID, ok := claims["user_id"].(float64)
-			if !ok || userID == 0 {
-				sendJSONError(w, "Invalid user ID", http.StatusUnauthorized, ctx)
+			// the request context is kept, so handlers notice when the client disconnects
+			next(w, r.WithContext(context.WithValue(r.Context(), "user_id", userID)))
+		}
+	}
+}
+
+// adminMiddleware lets through requests with the ADMIN_TOKEN bearer token, admin endpoints are disabled without it
+func adminMiddleware(ctx context.Context) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			adminToken := os.Getenv("ADMIN_TOKEN")
+			if adminToken == "" {
+				sendJSONError(w, "Admin endpoints are disabled", http.StatusForbidden, ctx)
+				return
+			}
+			authHeader := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(authHeader), []byte("Bearer "+adminToken)) != 1 {
+				sendJSONError(w, "Invalid admin token", http.StatusUnauthorized, ctx)
 				return
 			}
+			next(w, r)
+		}
+	}
+}
 
-			ctx = context.WithValue(ctx, "user_id", int(userID))
-			next(w, r.WithContext(ctx))
+// agentsHandler handles the /api/v1/admin/agents endpoint
+func agentsHandler(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logger2.GetLogger(ctx)
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		response := map[string]interface{}{
+			"agents": obj.Agents.List(),
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.Error("agentsHandler: could not encode response:", "err", err)
 		}
 	}
 }
@@ -291,7 +503,7 @@ func sendJSONError(w http.ResponseWriter, message string, code int, ctx context.
 }
 
 // registerHandler handles the /api/v1/register endpoint
-func registerHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
+func registerHandler(ctx context.Context, repo storage.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logger2.GetLogger(ctx)
 		var user obj.RegisterRequest
@@ -302,7 +514,22 @@ func registerHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = db.ExecContext(ctx, "INSERT INTO users (login, password) VALUES (?, ?)", user.Login, user.Password)
+		if err = validateCredentials(user.Login, user.Password); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Error("registerHandler: could not hash password:", "err", err)
+			return
+		}
+
+		_, err = repo.CreateUser(ctx, user.Login, hash)
+		if errors.Is(err, storage.ErrDuplicate) {
+			http.Error(w, "Login is already taken", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			logger.Error("registerHandler: could not insert user:", "err", err)
@@ -313,49 +540,51 @@ func registerHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GenerateToken generates jwt token
-func GenerateToken(userID int, secretKey string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secretKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %v", err)
-	}
-	return tokenString, nil
-}
-
 // loginHandler handles the /api/v1/login endpoint
-func loginHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
+func loginHandler(ctx context.Context, repo storage.Repository, keys *Keys) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logger2.GetLogger(ctx)
 		var user obj.LoginRequest
-		var id int
 		err := json.NewDecoder(r.Body).Decode(&user)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			logger.Error("loginHandler: could not decode request:", "err", err)
 			return
 		}
-		row := db.QueryRow("SELECT id FROM users WHERE login = ? AND password = ?", user.Login, user.Password)
-		err = row.Scan(&id)
+		id, stored, err := repo.User(ctx, user.Login)
+		if errors.Is(err, storage.ErrNotFound) {
+			checkPassword(dummyHash(), user.Password)
+			http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			logger.Error("loginHandler: could not find user:", "err", err)
 			return
 		}
+		ok, rehash := checkPassword(stored, user.Password)
+		if !ok {
+			http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+			return
+		}
+		if rehash {
+			// the login succeeds even if the new hash isn't stored, it is stored on the next login
+			hash, err := hashPassword(user.Password)
+			if err == nil {
+				err = repo.SetPassword(ctx, id, hash)
+			}
+			if err != nil {
+				logger.Error("loginHandler: could not rehash password:", "err", err)
+			}
+		}
 
-		token, err := GenerateToken(id, secretKey)
+		resp, err := issueTokens(ctx, repo, keys, id)
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			logger.Error("loginHandler: could not generate token:", "err", err)
 			return
 		}
 
-		resp := obj.LoginResponse{
-			Token: token,
-		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -365,24 +594,70 @@ func loginHandler(ctx context.Context, db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// refreshHandler handles the /api/v1/refresh endpoint, the refresh token is exchanged for new tokens once
+func refreshHandler(ctx context.Context, repo storage.Repository, keys *Keys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logger2.GetLogger(ctx)
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var request obj.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			http.Error(w, "Refresh token required", http.StatusBadRequest)
+			return
+		}
+		id, err := repo.UseRefreshToken(ctx, hashRefreshToken(request.RefreshToken), time.Now())
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			logger.Info("refreshHandler: rejected refresh token:", "err", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Error("refreshHandler: could not use refresh token:", "err", err)
+			return
+		}
+
+		resp, err := issueTokens(ctx, repo, keys, id)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			logger.Error("refreshHandler: could not generate token:", "err", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Error("refreshHandler: could not encode response:", "err", err)
+		}
+	}
+}
+
 // StartServer starts the server on port 8080 and listens for incoming requests
-func StartServer(ctx context.Context, db *sql.DB) error {
+func StartServer(ctx context.Context, repo storage.Repository, keys *Keys) error {
 	logger := logger2.GetLogger(ctx)
 
 	mux := http.NewServeMux()
 	//start synchronization DB with cache
-	err := syncDBWithCache(ctx, db)
+	err := syncDBWithCache(ctx, repo)
 	if err != nil {
 		return fmt.Errorf("syncDBWithCache: %w", err)
 	}
-	//start updating DB
-	startUpdatingDB(ctx, db)
+	//start keeping the expressions of the replica and resuming the expressions of stopped replicas
+	go keepOwnership(ctx, repo)
+	//start writing finished expressions to DB
+	go persistExpressions(ctx, repo)
 	// Handle functions for client requests
-	mux.HandleFunc("/api/v1/register", registerHandler(ctx, db))
-	mux.HandleFunc("/api/v1/login", loginHandler(ctx, db))
-	mux.HandleFunc("/api/v1/calculate", authMiddleware(ctx)(calculateHandler(ctx, db)))
-	mux.HandleFunc("/api/v1/expressions", authMiddleware(ctx)(expressionHandler(ctx, db)))
-	mux.HandleFunc("/api/v1/expressions/", authMiddleware(ctx)(expressionIDHandler(ctx, db)))
+	mux.HandleFunc("/api/v1/register", registerHandler(ctx, repo))
+	mux.HandleFunc("/api/v1/login", loginHandler(ctx, repo, keys))
+	mux.HandleFunc("/api/v1/refresh", refreshHandler(ctx, repo, keys))
+	mux.HandleFunc("/api/v1/calculate", authMiddleware(ctx, keys)(calculateHandler(ctx, repo)))
+	mux.HandleFunc("/api/v1/expressions", authMiddleware(ctx, keys)(expressionHandler(ctx, repo)))
+	mux.HandleFunc("/api/v1/expressions/", authMiddleware(ctx, keys)(expressionIDHandler(ctx, repo)))
+	mux.HandleFunc("GET /api/v1/expressions/{id}/events", authMiddleware(ctx, keys)(expressionEventsHandler(ctx, repo)))
+	// Handle functions for administrators
+	mux.HandleFunc("/api/v1/admin/agents", adminMiddleware(ctx)(agentsHandler(ctx)))
 	// Start the server
 	logger.Info("StartServer: server started")
 	err = http.ListenAndServe(":8080", mux)
@@ -1,46 +1,343 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	obj "orchestrator/internal/entities"
+	"orchestrator/internal/parser"
+	"orchestrator/internal/storage"
+	"os"
 	logger2 "pkg/logger"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
-// TestIsValidExpression tests the isValidExpression function
-func TestIsValidExpression(t *testing.T) {
+// TestCalculateHandler_ValidatesExpression tests that calculateHandler accepts only valid expressions
+func TestCalculateHandler_ValidatesExpression(t *testing.T) {
 	tests := []struct {
 		name       string
 		expression string
-		expected   bool
+		code       int
+		err        string
 	}{
-		{"valid simple", "2 + 3", true},
-		{"valid with parentheses", "4 * (5 - 2)", true},
-		{"invalid character", "2 + a", false},
-		{"empty string", "", false},
+		{"valid simple", "2 + 3", http.StatusCreated, ""},
+		{"valid with parentheses", "4 * (5 - 2)", http.StatusCreated, ""},
+		{"valid decimal", "3.14 * 2", http.StatusCreated, ""},
+		{"valid leading dot", ".5 + 1", http.StatusCreated, ""},
+		{"valid scientific notation", "1e-3 + 2E5", http.StatusCreated, ""},
+		{"valid power, modulo and integer division", "2 ^ 3 % 5 // 2", http.StatusCreated, ""},
+		{"valid function calls", "sqrt(16) + max(3, 7, 2)", http.StatusCreated, ""},
+		{"invalid character", "2 + a", http.StatusUnprocessableEntity, "expected function name, got 'a' at position 5\n2 + a\n    ^"},
+		{"unknown function", "tan(1)", http.StatusUnprocessableEntity, "expected function name, got 'tan' at position 1\ntan(1)\n^"},
+		{"malformed number", "1..2", http.StatusUnprocessableEntity, "expected digit, got '.' at position 3\n1..2\n  ^"},
+		{"empty string", "", http.StatusUnprocessableEntity, "expected expression, got end of expression at position 1\n\n^"},
 	}
 
-	for _, tt := range tests {
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isValidExpression(tt.expression)
-			assert.Equal(t, tt.expected, got, "isValidExpression(%q) = %v, want %v", tt.expression, got, tt.expected)
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			if tt.code == http.StatusCreated {
+				mock.ExpectQuery("INSERT INTO expressions").
+					WithArgs(1, tt.expression, "In progress", "float", 0, sqlmock.AnyArg(), replicaId, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(100 + i))
+			}
+
+			ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+			body, _ := json.Marshal(obj.ClientRequest{Expression: tt.expression})
+			req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+			rr := httptest.NewRecorder()
+			calculateHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			var response obj.ClientResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, tt.err, response.Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
-// TestCalculateHandler_InvalidExpression tests calculateHandler with an invalid expression
-func TestCalculateHandler_InvalidExpression(t *testing.T) {
-	db, _, err := sqlmock.New()
+// TestCalculateHandler_Mode tests that calculateHandler accepts only expressions that can be evaluated in the requested mode
+func TestCalculateHandler_Mode(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		mode       string
+		storedMode string
+		code       int
+		err        string
+	}{
+		{"default mode", "sqrt(2)", "", "float", http.StatusCreated, ""},
+		{"decimal mode", "0.1 + 0.2", "decimal", "decimal", http.StatusCreated, ""},
+		{"unknown mode", "0.1 + 0.2", "binary", "", http.StatusUnprocessableEntity, `unknown mode "binary", expected float or decimal`},
+		{"inexact function in decimal mode", "sqrt(2)", "decimal", "", http.StatusUnprocessableEntity, "expected operation supported in decimal mode, got 'sqrt' at position 1\nsqrt(2)\n^"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			if tt.code == http.StatusCreated {
+				mock.ExpectQuery("INSERT INTO expressions").
+					WithArgs(1, tt.expression, "In progress", tt.storedMode, 0, sqlmock.AnyArg(), replicaId, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(200 + i))
+			}
+
+			ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+			body, _ := json.Marshal(obj.ClientRequest{Expression: tt.expression, Mode: tt.mode})
+			req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+			rr := httptest.NewRecorder()
+			calculateHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			var response obj.ClientResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, tt.err, response.Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestCalculateHandler_Priority tests that the priority of the expression is stored
+func TestCalculateHandler_Priority(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
+	mock.ExpectQuery("INSERT INTO expressions").
+		WithArgs(1, "2 + 3", "In progress", "float", 5, sqlmock.AnyArg(), replicaId, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(300))
+
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	body, _ := json.Marshal(obj.ClientRequest{Expression: "2 + 3", Priority: 5})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+	rr := httptest.NewRecorder()
+	calculateHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(nil, nil)))
-	token, _ := GenerateToken(1, secretKey)
+// responseColumns are the columns of the expression read by the handlers
+var responseColumns = []string{"result", "status", "mode", "decimal_result", "error", "operations", "created_at", "started_at", "finished_at"}
+
+// TestExpressionIDHandler_DecimalResult tests that exact results are sent as strings
+func TestExpressionIDHandler_DecimalResult(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT result, status, mode, decimal_result").
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows(responseColumns).AddRow(0.3, "Done", "decimal", "0.3", nil, 1, nil, nil, nil))
+
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	req, _ := http.NewRequest("GET", "/api/v1/expressions/7", nil)
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+	rr := httptest.NewRecorder()
+	expressionIDHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": 7, "status": "Done", "result": "0.3", "mode": "decimal", "operations": 1}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestExpressionIDHandler_Timestamps tests that the error, the timestamps and the duration of the expression are sent
+func TestExpressionIDHandler_Timestamps(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT result, status, mode, decimal_result").
+		WithArgs(1, 8).
+		WillReturnRows(sqlmock.NewRows(responseColumns).
+			AddRow(0, "Fail", "float", nil, "division by zero", 2, created, created.Add(time.Second), created.Add(1500*time.Millisecond)))
+
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	req, _ := http.NewRequest("GET", "/api/v1/expressions/8", nil)
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+	rr := httptest.NewRecorder()
+	expressionIDHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": 8, "status": "Fail", "error": "division by zero", "mode": "float", "operations": 2,
+		"created_at": "2025-01-02T03:04:05Z", "started_at": "2025-01-02T03:04:06Z", "finished_at": "2025-01-02T03:04:06.5Z", "duration_ms": 500}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestExpressionEventsHandler tests that the status and the step results of the expression are streamed until it is finished
+func TestExpressionEventsHandler(t *testing.T) {
+	repo := storage.NewMemory()
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	expr := obj.ClientResponse{Id: 900, Status: "In progress"}
+	expr.SetUserId(1)
+	obj.Expressions.Set("900", expr)
+	defer obj.Expressions.Delete("900")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/expressions/", authMiddleware(ctx, testKeys)(expressionIDHandler(ctx, repo)))
+	mux.HandleFunc("GET /api/v1/expressions/{id}/events", authMiddleware(ctx, testKeys)(expressionEventsHandler(ctx, repo)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	token, _ := GenerateToken(1, testKeys)
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/expressions/900/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var event string
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			if line == "\n" {
+				return event
+			}
+			event += line
+		}
+	}
+
+	assert.Equal(t, "event: status\ndata: {\"id\":900,\"status\":\"In progress\"}\n", readEvent())
+	obj.Events.Publish("900", obj.ExpressionEvent{Name: obj.EventStep, Data: obj.StepResult{TaskId: "900.1", Operation: "+", Result: 5}})
+	expr.Status, expr.Result = "Done", 5
+	obj.Events.Publish("900", obj.ExpressionEvent{Name: obj.EventStatus, Data: expr})
+	assert.Equal(t, "event: step\ndata: {\"task_id\":\"900.1\",\"operation\":\"+\",\"result\":5}\n", readEvent())
+	assert.Equal(t, "event: status\ndata: {\"id\":900,\"status\":\"Done\",\"result\":5}\n", readEvent())
+	// the stream is closed once the expression is finished
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// TestExpressionEventsHandler_Disconnect tests that the stream of an unfinished expression ends when the client disconnects
+func TestExpressionEventsHandler_Disconnect(t *testing.T) {
+	repo := storage.NewMemory()
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	expr := obj.ClientResponse{Id: 930, Status: "In progress"}
+	expr.SetUserId(1)
+	obj.Expressions.Set("930", expr)
+	defer obj.Expressions.Delete("930")
+
+	returned := make(chan struct{})
+	handler := authMiddleware(ctx, testKeys)(expressionEventsHandler(ctx, repo))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/expressions/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+		close(returned)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	token, _ := GenerateToken(1, testKeys)
+	requestCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(requestCtx, "GET", server.URL+"/api/v1/expressions/930/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: status\n", line)
+
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the handler is still streaming after the client disconnected")
+	}
+}
+
+// TestExpressionEventsHandler_NotFound tests that expressions of other users are not streamed
+func TestExpressionEventsHandler_NotFound(t *testing.T) {
+	repo := storage.NewMemory()
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	expr := obj.ClientResponse{Id: 901, Status: "In progress"}
+	expr.SetUserId(2)
+	obj.Expressions.Set("901", expr)
+	defer obj.Expressions.Delete("901")
+
+	for _, id := range []string{"901", "902"} {
+		req, _ := http.NewRequest("GET", "/api/v1/expressions/"+id+"/events", nil)
+		req.SetPathValue("id", id)
+		req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+		rr := httptest.NewRecorder()
+		expressionEventsHandler(ctx, repo).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	}
+}
+
+// TestExpressionHandlers_ReadThroughCache tests that finished expressions are visible before they are flushed to DB
+func TestExpressionHandlers_ReadThroughCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	expr := obj.ClientResponse{Id: 910, Status: "Done", Result: 5}
+	expr.SetUserId(1)
+	obj.Expressions.Set("910", expr)
+	defer obj.Expressions.Delete("910")
+	// the expression of another user with the same id in the cache is not shown
+	other := obj.ClientResponse{Id: 911, Status: "Fail", Error: "division by zero"}
+	other.SetUserId(2)
+	obj.Expressions.Set("911", other)
+	defer obj.Expressions.Delete("911")
+
+	mock.ExpectQuery("SELECT id, result, status, mode, decimal_result").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(append([]string{"id"}, responseColumns...)).
+			AddRow(910, 0, "In progress", "float", nil, nil, 1, nil, nil, nil).
+			AddRow(911, 0, "In progress", "float", nil, nil, 1, nil, nil, nil))
+	req, _ := http.NewRequest("GET", "/api/v1/expressions", nil)
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+	rr := httptest.NewRecorder()
+	expressionHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"expressions": [{"id": 910, "status": "Done", "result": 5}, {"id": 911, "status": "In progress", "mode": "float", "operations": 1}]}`, rr.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/v1/expressions/910", nil)
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+	rr = httptest.NewRecorder()
+	expressionIDHandler(ctx, storage.NewSQLite(db)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": 910, "status": "Done", "result": 5}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCalculateHandler_InvalidExpression tests calculateHandler with an invalid expression
+func TestCalculateHandler_InvalidExpression(t *testing.T) {
+	repo := storage.NewMemory()
+
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	token, _ := GenerateToken(1, testKeys)
 
 	reqBody := `{"expression": "2 + a"}`
 	req, _ := http.NewRequest("POST", "/api/v1/calculate", strings.NewReader(reqBody))
@@ -49,15 +346,54 @@ func TestCalculateHandler_InvalidExpression(t *testing.T) {
 	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
 
 	rr := httptest.NewRecorder()
-	handler := calculateHandler(ctx, db)
+	handler := calculateHandler(ctx, repo)
 	handler.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
 }
 
+// TestCalculateHandler_Limits tests that too large requests and too long expressions are rejected before they are parsed
+func TestCalculateHandler_Limits(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	tests := []struct {
+		name       string
+		expression string
+		code       int
+		err        string
+	}{
+		{"too large body", strings.Repeat("-", 5_000_000) + "1", http.StatusRequestEntityTooLarge, ""},
+		{"too long expression", strings.Repeat("-", parser.MaxExpressionLength) + "1", http.StatusUnprocessableEntity, "expression is longer than 10000 bytes"},
+		{"too deep expression", strings.Repeat("-", 1000) + "1", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(obj.ClientRequest{Expression: tt.expression})
+			req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewReader(body))
+			req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+
+			rr := httptest.NewRecorder()
+			calculateHandler(ctx, storage.NewMemory()).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			if tt.err != "" {
+				var response obj.ClientResponse
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+				assert.Equal(t, tt.err, response.Error)
+			}
+		})
+	}
+}
+
+// testSecret is the secret of testKeys
+var testSecret = strings.Repeat("s", minSecretLength)
+
+// testKeys are the keys tokens are signed with in tests
+var testKeys, _ = ParseKeys("test:" + testSecret)
+
 // TestAuthMiddleware_ValidToken tests authMiddleware with a valid token
 func TestAuthMiddleware_ValidToken(t *testing.T) {
-	token, _ := GenerateToken(1, secretKey)
+	token, _ := GenerateToken(1, testKeys)
 	req, _ := http.NewRequest("GET", "/", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -69,28 +405,408 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := authMiddleware(context.Background())
+	middleware := authMiddleware(context.Background(), testKeys)
 	handler := middleware(dummyHandler)
 	handler.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 }
 
+// TestRegisterHandler tests that registerHandler validates credentials, stores password hashes and rejects taken logins
+func TestRegisterHandler(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	repo := storage.NewMemory()
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		code     int
+	}{
+		{"valid", "user_1", "password", http.StatusOK},
+		{"taken login", "user_1", "password", http.StatusConflict},
+		{"short login", "us", "password", http.StatusBadRequest},
+		{"invalid login character", "user 2", "password", http.StatusBadRequest},
+		{"short password", "user_2", "pass", http.StatusBadRequest},
+		{"long password", "user_2", strings.Repeat("p", 73), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(obj.RegisterRequest{Login: tt.login, Password: tt.password})
+			req, _ := http.NewRequest("POST", "/api/v1/register", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			registerHandler(ctx, repo).ServeHTTP(rr, req)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+
+	_, stored, err := repo.User(ctx, "user_1")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "password", stored)
+	ok, rehash := checkPassword(stored, "password")
+	assert.True(t, ok)
+	assert.False(t, rehash)
+}
+
+// TestLoginHandler tests that loginHandler checks passwords and hashes the plaintext passwords of old users
+func TestLoginHandler(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	repo := storage.NewMemory()
+	id, err := repo.CreateUser(ctx, "legacy", "plaintext")
+	assert.NoError(t, err)
+
+	login := func(login string, password string) int {
+		body, _ := json.Marshal(obj.LoginRequest{Login: login, Password: password})
+		req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		loginHandler(ctx, repo, testKeys).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("legacy", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, login("unknown", "plaintext"))
+	_, stored, err := repo.User(ctx, "legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, "plaintext", stored)
+
+	assert.Equal(t, http.StatusOK, login("legacy", "plaintext"))
+	found, stored, err := repo.User(ctx, "legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, id, found)
+	assert.True(t, strings.HasPrefix(stored, "$2"))
+	assert.Equal(t, http.StatusOK, login("legacy", "plaintext"))
+	assert.Equal(t, http.StatusUnauthorized, login("legacy", "wrong"))
+}
+
+// signToken signs the claims with the secret and the kid header
+func signToken(claims jwt.Claims, kid string, secret string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	tokenString, _ := token.SignedString([]byte(secret))
+	return tokenString
+}
+
+// TestAuthMiddleware_Claims tests that authMiddleware accepts only unexpired tokens of the orchestrator signed with known keys
+func TestAuthMiddleware_Claims(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	newSecret := strings.Repeat("n", minSecretLength)
+	rotated, err := ParseKeys("new:" + newSecret + "\ntest:" + testSecret)
+	assert.NoError(t, err)
+	now := time.Now()
+	claims := func(issuer string, issued time.Time, expires *jwt.NumericDate) accessClaims {
+		return accessClaims{UserId: 1, RegisteredClaims: jwt.RegisteredClaims{Issuer: issuer, IssuedAt: jwt.NewNumericDate(issued), ExpiresAt: expires}}
+	}
+	valid := claims(tokenIssuer, now, jwt.NewNumericDate(now.Add(time.Minute)))
+	rotatedToken, err := GenerateToken(1, rotated)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+		keys  *Keys
+		code  int
+	}{
+		{"valid", signToken(valid, "test", testSecret), testKeys, http.StatusOK},
+		{"signed with previous key after rotation", signToken(valid, "test", testSecret), rotated, http.StatusOK},
+		{"signed with current key after rotation", rotatedToken, rotated, http.StatusOK},
+		{"signed with key unknown before rotation", rotatedToken, testKeys, http.StatusUnauthorized},
+		{"wrong secret", signToken(valid, "test", newSecret), testKeys, http.StatusUnauthorized},
+		{"no kid", signToken(valid, "", testSecret), testKeys, http.StatusUnauthorized},
+		{"expired", signToken(claims(tokenIssuer, now.Add(-time.Hour), jwt.NewNumericDate(now.Add(-time.Minute))), "test", testSecret), testKeys, http.StatusUnauthorized},
+		{"no exp", signToken(claims(tokenIssuer, now, nil), "test", testSecret), testKeys, http.StatusUnauthorized},
+		{"issued in future", signToken(claims(tokenIssuer, now.Add(time.Hour), jwt.NewNumericDate(now.Add(2*time.Hour))), "test", testSecret), testKeys, http.StatusUnauthorized},
+		{"no iat", signToken(accessClaims{UserId: 1, RegisteredClaims: jwt.RegisteredClaims{Issuer: tokenIssuer, ExpiresAt: valid.ExpiresAt}}, "test", testSecret), testKeys, http.StatusUnauthorized},
+		{"wrong issuer", signToken(claims("someone", now, valid.ExpiresAt), "test", testSecret), testKeys, http.StatusUnauthorized},
+		{"without claims of the orchestrator", signToken(jwt.MapClaims{"user_id": 1}, "test", testSecret), testKeys, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			authMiddleware(ctx, tt.keys)(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, 1, r.Context().Value("user_id"))
+			}).ServeHTTP(rr, req)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+}
+
+// TestParseKeys tests parsing of the keys, the first key signs tokens
+func TestParseKeys(t *testing.T) {
+	secret := strings.Repeat("a", minSecretLength)
+	tests := []struct {
+		name    string
+		text    string
+		current string
+		kids    []string
+		wantErr bool
+	}{
+		{"secret without kid", secret, defaultKeyId, []string{defaultKeyId}, false},
+		{"keys separated by commas", "2:" + secret + ",1:" + secret, "2", []string{"1", "2"}, false},
+		{"keys separated by new lines", "2:" + secret + "\n1:" + secret + "\n", "2", []string{"1", "2"}, false},
+		{"secret with colon", "1:" + secret + ":" + secret, "1", []string{"1"}, false},
+		{"short secret", "1:short", "", nil, true},
+		{"empty kid", ":" + secret, "", nil, true},
+		{"duplicate kid", "1:" + secret + ",1:" + secret, "", nil, true},
+		{"no keys", " \n", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseKeys(tt.text)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.current, keys.current)
+			var kids []string
+			for kid := range keys.secrets {
+				kids = append(kids, kid)
+			}
+			assert.ElementsMatch(t, tt.kids, kids)
+		})
+	}
+}
+
+// TestLoadKeys tests that the keys are loaded from the file and a random key is generated without configuration
+func TestLoadKeys(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	path := t.TempDir() + "/jwt_secret"
+	assert.NoError(t, os.WriteFile(path, []byte("file:"+testSecret+"\n"), 0o600))
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_SECRET_FILE", path)
+	keys, err := LoadKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "file", keys.current)
+	assert.Equal(t, []byte(testSecret), keys.secrets["file"])
+
+	t.Setenv("JWT_SECRET", testSecret)
+	_, err = LoadKeys(ctx)
+	assert.Error(t, err)
+
+	t.Setenv("JWT_SECRET_FILE", "")
+	t.Setenv("JWT_SECRET", "")
+	first, err := LoadKeys(ctx)
+	assert.NoError(t, err)
+	second, err := LoadKeys(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, first.secrets[defaultKeyId], minSecretLength)
+	assert.NotEqual(t, first.secrets, second.secrets)
+}
+
+// TestRefreshHandler tests that refresh tokens are exchanged for new tokens once and a reused token revokes the new ones
+func TestRefreshHandler(t *testing.T) {
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	repo := storage.NewMemory()
+	hash, err := hashPassword("password")
+	assert.NoError(t, err)
+	id, err := repo.CreateUser(ctx, "user", hash)
+	assert.NoError(t, err)
+
+	body, _ := json.Marshal(obj.LoginRequest{Login: "user", Password: "password"})
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	loginHandler(ctx, repo, testKeys).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var login obj.LoginResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&login))
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, accessTokenTTLMs/1000, login.ExpiresIn)
+
+	refresh := func(token string) (int, obj.LoginResponse) {
+		body, _ := json.Marshal(obj.RefreshRequest{RefreshToken: token})
+		req, _ := http.NewRequest("POST", "/api/v1/refresh", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		refreshHandler(ctx, repo, testKeys).ServeHTTP(rr, req)
+		var response obj.LoginResponse
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		}
+		return rr.Code, response
+	}
+
+	code, refreshed := refresh(login.RefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	userId, err := parseToken(refreshed.Token, testKeys)
+	assert.NoError(t, err)
+	assert.Equal(t, id, userId)
+
+	code, _ = refresh("unknown")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh("")
+	assert.Equal(t, http.StatusBadRequest, code)
+	// the first token is reused, so the token issued for it is revoked as well
+	code, _ = refresh(login.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+// TestAgentsHandler tests that registered agents are listed only to administrators
+func TestAgentsHandler(t *testing.T) {
+	obj.Agents.Register(obj.Agent{Id: "agent-1", Hostname: "host", ComputingPower: 2, Operations: []string{"+"}}, time.Unix(0, 0).UTC())
+	obj.Agents.Assign("agent-1", "1.1")
+	defer obj.Agents.Expire(time.Now())
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		code       int
+	}{
+		{"admin token", "admin", "Bearer admin", http.StatusOK},
+		{"wrong token", "admin", "Bearer user", http.StatusUnauthorized},
+		{"admin endpoints disabled", "", "Bearer ", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_TOKEN", tt.adminToken)
+			req, _ := http.NewRequest("GET", "/api/v1/admin/agents", nil)
+			req.Header.Set("Authorization", tt.header)
+
+			rr := httptest.NewRecorder()
+			adminMiddleware(ctx)(agentsHandler(ctx)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			if tt.code == http.StatusOK {
+				assert.JSONEq(t, `{"agents": [{"id": "agent-1", "hostname": "host", "computing_power": 2, "operations": ["+"], "last_seen": "1970-01-01T00:00:00Z", "in_flight": 1}]}`, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestPersistExpressions tests that finished expressions are written in one transaction and a failed batch is retried one element at a time
+func TestPersistExpressions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectBegin().WillReturnError(errors.New("database is locked"))
+	// the failed batch is written one element at a time
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO expression_steps").
+		WithArgs(920, 1, "+", `["2","3"]`, 5.0, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE expressions").WithArgs(1, 5.0, "Done", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 920).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM expression_steps").WithArgs(920).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE expressions").WithArgs(1, 0.3, "Done", "0.3", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 921).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM expression_steps").WithArgs(921).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	obj.Outbox.Enqueue(obj.StepResult{ExpressionId: 920, Step: 1, Operation: "+", Args: []string{"2", "3"}, Result: 5})
+	for _, expr := range []obj.ClientResponse{
+		{Id: 920, Status: "Done", Result: 5, Operations: 1},
+		{Id: 921, Status: "Done", Result: 0.3, Mode: obj.ModeDecimal, Decimal: "0.3", Operations: 1},
+	} {
+		expr.SetUserId(1)
+		obj.Expressions.Set(strconv.Itoa(expr.Id), expr)
+		obj.Outbox.Enqueue(expr)
+	}
+	ctx, cancel := context.WithCancel(logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(os.Stdout, nil))))
+	defer cancel()
+
+	go persistExpressions(ctx, storage.NewSQLite(db))
+
+	// the expressions are kept in the cache until they are written
+	assert.Eventually(t, func() bool {
+		return obj.Expressions.Get("920") == nil && obj.Expressions.Get("921") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestSyncDBWithCache tests syncDBWithCache
 func TestSyncDBWithCache(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "expression"}).
-		AddRow(1, 1, "2 + 3").
-		AddRow(2, 1, "4 * 5")
-	mock.ExpectQuery("SELECT id, user_id, expression FROM expressions WHERE status = ?").
-		WithArgs("In progress").
+	// the expressions without a running owner are claimed by the replica
+	rows := sqlmock.NewRows([]string{"id", "user_id", "expression", "mode", "priority", "created_at"}).
+		AddRow(1, 1, "2 + 3", "float", 0, time.Now()).
+		AddRow(2, 1, "4 * 5", "decimal", 5, time.Now())
+	mock.ExpectQuery("UPDATE expressions SET owner = \\?, heartbeat_at = \\? WHERE status = \\?").
+		WithArgs(replicaId, sqlmock.AnyArg(), "In progress", replicaId, sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	// the only operation of the first expression was computed before the restart
+	steps := sqlmock.NewRows([]string{"expression_id", "step", "operation", "result", "decimal_result"}).
+		AddRow(1, 1, "+", 5.0, nil)
+	mock.ExpectQuery("SELECT expression_id, step, operation, result, decimal_result FROM expression_steps").
+		WithArgs("In progress").
+		WillReturnRows(steps)
 
-	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(nil, nil)))
-	err = syncDBWithCache(ctx, db)
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	err = syncDBWithCache(ctx, storage.NewSQLite(db))
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
+	// the first expression is finished without dispatching tasks and is put into the outbox
+	assert.Eventually(t, func() bool {
+		expr, ok := obj.Outbox.Dequeue().(obj.ClientResponse)
+		return ok && expr.Id == 1 && expr.Status == "Done" && expr.Result == 5
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestPersistExpressions_ParksFailingElement tests that an element that can't be written doesn't block the outbox
+func TestPersistExpressions_ParksFailingElement(t *testing.T) {
+	defer func(attempts int) { maxWriteAttempts = attempts }(maxWriteAttempts)
+	maxWriteAttempts = 1
+	for obj.Outbox.Dequeue() != nil {
+	}
+	ctx, cancel := context.WithCancel(logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil))))
+	defer cancel()
+	repo := storage.NewMemory()
+	var ids []int
+	for range 3 {
+		id, err := repo.CreateExpression(ctx, obj.Expression{UserId: 1, Expression: "2 + 3", Mode: obj.ModeFloat, CreatedAt: time.Now()})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	finish := func(id int) {
+		expr := obj.ClientResponse{Id: id, Status: "Done", Result: 5, Operations: 1}
+		expr.SetUserId(1)
+		obj.Expressions.Set(strconv.Itoa(id), expr)
+		obj.Outbox.Enqueue(expr)
+	}
+
+	// the repository can't write the element between the expressions
+	finish(ids[0])
+	obj.Outbox.Enqueue("unexpected")
+	finish(ids[1])
+	go persistExpressions(ctx, repo)
+
+	written := func(id int) bool {
+		expr, err := repo.Expression(ctx, 1, id)
+		return err == nil && expr.Status == "Done" && obj.Expressions.Get(strconv.Itoa(id)) == nil
+	}
+	assert.Eventually(t, func() bool { return written(ids[0]) && written(ids[1]) }, 5*time.Second, 10*time.Millisecond)
+	// the failing element is parked, so the next expressions are written without backoff
+	finish(ids[2])
+	assert.Eventually(t, func() bool { return written(ids[2]) && obj.Outbox.IsEmpty() }, time.Second, 10*time.Millisecond)
+}
+
+// TestCalculateHandler_OutboxFull tests that new expressions are rejected while the outbox is full
+func TestCalculateHandler_OutboxFull(t *testing.T) {
+	defer func(size int) { maxOutbox = size }(maxOutbox)
+	maxOutbox = 1
+	for obj.Outbox.Dequeue() != nil {
+	}
+	obj.Outbox.Enqueue(obj.StepResult{ExpressionId: 1, Step: 1, Operation: "+", Args: []string{"2", "3"}, Result: 5})
+	defer obj.Outbox.Dequeue()
+	ctx := logger2.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	body, _ := json.Marshal(obj.ClientRequest{Expression: "2 + 3"})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(ctx, "user_id", 1))
+	rr := httptest.NewRecorder()
+	calculateHandler(ctx, storage.NewMemory()).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
 }
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	obj "orchestrator/internal/entities"
+	"orchestrator/internal/storage"
+	"os"
+	"pkg"
+	logger2 "pkg/logger"
+	"strings"
+	"time"
+)
+
+// Lifetime of tokens in milliseconds
+var (
+	accessTokenTTLMs  = pkg.GetEnvAsInt("ACCESS_TOKEN_TTL_MS", 15*60*1000)
+	refreshTokenTTLMs = pkg.GetEnvAsInt("REFRESH_TOKEN_TTL_MS", 30*24*60*60*1000)
+)
+
+const (
+	// tokenIssuer is the iss claim of access tokens
+	tokenIssuer = "orchestrator"
+	// defaultKeyId is the kid of the key given without one
+	defaultKeyId = "default"
+	// minSecretLength is the least length of secrets in bytes, shorter ones can be brute-forced
+	minSecretLength = 32
+)
+
+// Keys are the HMAC secrets of access tokens by key id (kid). Tokens are signed with the current key
+// and are accepted if they are signed with any of the keys, so the current key is replaced without logging users out
+type Keys struct {
+	current string
+	secrets map[string][]byte
+}
+
+// ParseKeys parses keys separated by commas or new lines, a key is kid:secret or a secret with the default kid;
+// the first key is the current one
+func ParseKeys(text string) (*Keys, error) {
+	keys := &Keys{secrets: make(map[string][]byte)}
+	for _, key := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(key, ":")
+		if !ok {
+			kid, secret = defaultKeyId, key
+		}
+		if kid == "" {
+			return nil, errors.New("ParseKeys: empty key id")
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("ParseKeys: secret of key %q is shorter than %d bytes", kid, minSecretLength)
+		}
+		if _, ok = keys.secrets[kid]; ok {
+			return nil, fmt.Errorf("ParseKeys: duplicate key id %q", kid)
+		}
+		if keys.current == "" {
+			keys.current = kid
+		}
+		keys.secrets[kid] = []byte(secret)
+	}
+	if keys.current == "" {
+		return nil, errors.New("ParseKeys: no keys")
+	}
+	return keys, nil
+}
+
+// LoadKeys loads the keys from the JWT_SECRET variable or from the file named by JWT_SECRET_FILE.
+// A random key is generated if neither is set, tokens signed with it are invalid after a restart
+func LoadKeys(ctx context.Context) (*Keys, error) {
+	logger := logger2.GetLogger(ctx)
+	text := os.Getenv("JWT_SECRET")
+	if path := os.Getenv("JWT_SECRET_FILE"); path != "" {
+		if text != "" {
+			return nil, errors.New("LoadKeys: both JWT_SECRET and JWT_SECRET_FILE are set")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeys: %w", err)
+		}
+		text = string(content)
+	}
+	if text == "" {
+		secret := make([]byte, minSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("LoadKeys: %w", err)
+		}
+		logger.Warn("LoadKeys: JWT_SECRET is not set, tokens are signed with a random key and are invalid after a restart")
+		return &Keys{current: defaultKeyId, secrets: map[string][]byte{defaultKeyId: secret}}, nil
+	}
+	keys, err := ParseKeys(text)
+	if err != nil {
+		return nil, fmt.Errorf("LoadKeys: %w", err)
+	}
+	return keys, nil
+}
+
+// accessClaims are the claims of access tokens
+type accessClaims struct {
+	UserId int `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken generates jwt token of the user signed with the current key
+func GenerateToken(userID int, keys *Keys) (string, error) {
+	now := time.Now()
+	claims := accessClaims{
+		UserId: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(accessTokenTTLMs) * time.Millisecond)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = keys.current
+	tokenString, err := token.SignedString(keys.secrets[keys.current])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return tokenString, nil
+}
+
+// parseToken returns the user of the access token, the token has to be signed with one of the keys,
+// issued by the orchestrator and not expired
+func parseToken(tokenString string, keys *Keys) (int, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := keys.secrets[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return secret, nil
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}), jwt.WithIssuer(tokenIssuer), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, fmt.Errorf("parseToken: %w", err)
+	}
+	if claims.IssuedAt == nil {
+		return 0, errors.New("parseToken: token has no iat claim")
+	}
+	return claims.UserId, nil
+}
+
+// hashRefreshToken returns the hash of the refresh token stored in DB, so stolen rows can't be used as tokens
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens generates the access token and stores the refresh token of the user
+func issueTokens(ctx context.Context, repo storage.Repository, keys *Keys, userId int) (obj.LoginResponse, error) {
+	token, err := GenerateToken(userId, keys)
+	if err != nil {
+		return obj.LoginResponse{}, fmt.Errorf("issueTokens: %w", err)
+	}
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return obj.LoginResponse{}, fmt.Errorf("issueTokens: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(random)
+	expiresAt := time.Now().Add(time.Duration(refreshTokenTTLMs) * time.Millisecond)
+	if err = repo.CreateRefreshToken(ctx, userId, hashRefreshToken(refreshToken), expiresAt); err != nil {
+		return obj.LoginResponse{}, fmt.Errorf("issueTokens: %w", err)
+	}
+	return obj.LoginResponse{Token: token, RefreshToken: refreshToken, ExpiresIn: accessTokenTTLMs / 1000}, nil
+}
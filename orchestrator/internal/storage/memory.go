@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	obj "orchestrator/internal/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryUser struct {
+	id       int
+	password string
+}
+
+type memoryRefreshToken struct {
+	userId    int
+	expiresAt time.Time
+	used      bool
+}
+
+type memoryExpression struct {
+	obj.Expression
+	response    obj.ClientResponse
+	heartbeatAt time.Time
+}
+
+// Memory is the Repository that keeps everything in memory, it is used in tests and for local runs
+type Memory struct {
+	users         map[string]memoryUser
+	refreshTokens map[string]memoryRefreshToken
+	expressions   map[int]*memoryExpression
+	steps         map[int]map[int]obj.StepResult
+	// lastUserId and lastExpressionId are the ids given to the last created rows
+	lastUserId       int
+	lastExpressionId int
+	mutex            sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:         make(map[string]memoryUser),
+		refreshTokens: make(map[string]memoryRefreshToken),
+		expressions:   make(map[int]*memoryExpression),
+		steps:         make(map[int]map[int]obj.StepResult),
+	}
+}
+
+func (m *Memory) CreateUser(_ context.Context, login string, password string) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.users[login]; ok {
+		return 0, fmt.Errorf("CreateUser: %w", ErrDuplicate)
+	}
+	m.lastUserId++
+	m.users[login] = memoryUser{id: m.lastUserId, password: password}
+	return m.lastUserId, nil
+}
+
+func (m *Memory) User(_ context.Context, login string) (int, string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	user, ok := m.users[login]
+	if !ok {
+		return 0, "", fmt.Errorf("User: %w", ErrNotFound)
+	}
+	return user.id, user.password, nil
+}
+
+func (m *Memory) SetPassword(_ context.Context, id int, password string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for login, user := range m.users {
+		if user.id == id {
+			m.users[login] = memoryUser{id: id, password: password}
+			return nil
+		}
+	}
+	return fmt.Errorf("SetPassword: %w", ErrNotFound)
+}
+
+func (m *Memory) CreateRefreshToken(_ context.Context, userId int, hash string, expiresAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	for tokenHash, token := range m.refreshTokens {
+		if token.userId == userId && !token.expiresAt.After(now) {
+			delete(m.refreshTokens, tokenHash)
+		}
+	}
+	m.refreshTokens[hash] = memoryRefreshToken{userId: userId, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *Memory) UseRefreshToken(_ context.Context, hash string, now time.Time) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	token, ok := m.refreshTokens[hash]
+	if !ok {
+		return 0, fmt.Errorf("UseRefreshToken: %w", ErrNotFound)
+	}
+	if token.used {
+		for tokenHash, other := range m.refreshTokens {
+			if other.userId == token.userId {
+				delete(m.refreshTokens, tokenHash)
+			}
+		}
+		return 0, fmt.Errorf("UseRefreshToken: token was used before: %w", ErrNotFound)
+	}
+	if !token.expiresAt.After(now) {
+		return 0, fmt.Errorf("UseRefreshToken: token expired: %w", ErrNotFound)
+	}
+	token.used = true
+	m.refreshTokens[hash] = token
+	return token.userId, nil
+}
+
+func (m *Memory) CreateExpression(_ context.Context, expr obj.Expression) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastExpressionId++
+	expr.Id = m.lastExpressionId
+	response := obj.ClientResponse{Id: expr.Id, Status: "In progress", Mode: expr.Mode}
+	if !expr.CreatedAt.IsZero() {
+		created := expr.CreatedAt
+		response.CreatedAt = &created
+	}
+	response.SetUserId(expr.UserId)
+	m.expressions[expr.Id] = &memoryExpression{Expression: expr, response: response, heartbeatAt: time.Now()}
+	return expr.Id, nil
+}
+
+func (m *Memory) Expressions(_ context.Context, userId int) ([]obj.ClientResponse, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var expressions []obj.ClientResponse
+	for _, expr := range m.expressions {
+		if expr.UserId == userId {
+			expressions = append(expressions, expr.response)
+		}
+	}
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].Id < expressions[j].Id })
+	return expressions, nil
+}
+
+func (m *Memory) Expression(_ context.Context, userId int, id int) (obj.ClientResponse, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	expr, ok := m.expressions[id]
+	if !ok || expr.UserId != userId {
+		return obj.ClientResponse{}, fmt.Errorf("Expression: %w", ErrNotFound)
+	}
+	return expr.response, nil
+}
+
+func (m *Memory) Unfinished(_ context.Context, owner string, expiredBefore time.Time) ([]obj.Expression, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var expressions []obj.Expression
+	for _, expr := range m.expressions {
+		if expr.response.Status != "In progress" {
+			continue
+		}
+		if expr.Owner != "" && (expr.Owner == owner || !expr.heartbeatAt.Before(expiredBefore)) {
+			continue
+		}
+		expr.Owner, expr.heartbeatAt = owner, time.Now()
+		expressions = append(expressions, expr.Expression)
+	}
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].Id < expressions[j].Id })
+	return expressions, nil
+}
+
+func (m *Memory) Heartbeat(_ context.Context, owner string, now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, expr := range m.expressions {
+		if expr.Owner == owner && expr.response.Status == "In progress" {
+			expr.heartbeatAt = now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CompletedSteps(_ context.Context) (map[int]map[int]obj.StepResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	steps := make(map[int]map[int]obj.StepResult)
+	for id, expressionSteps := range m.steps {
+		if expr, ok := m.expressions[id]; !ok || expr.response.Status != "In progress" {
+			continue
+		}
+		steps[id] = make(map[int]obj.StepResult, len(expressionSteps))
+		for number, step := range expressionSteps {
+			steps[id][number] = step
+		}
+	}
+	return steps, nil
+}
+
+func (m *Memory) Write(_ context.Context, batch []interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, element := range batch {
+		if _, ok := element.(obj.StepResult); !ok {
+			if _, ok = element.(obj.ClientResponse); !ok {
+				return fmt.Errorf("Write: unexpected element %T", element)
+			}
+		}
+	}
+	for _, element := range batch {
+		switch e := element.(type) {
+		case obj.StepResult:
+			if m.steps[e.ExpressionId] == nil {
+				m.steps[e.ExpressionId] = make(map[int]obj.StepResult)
+			}
+			if _, ok := m.steps[e.ExpressionId][e.Step]; !ok {
+				// only the fields stored by SQL databases are kept
+				m.steps[e.ExpressionId][e.Step] = obj.StepResult{
+					TaskId:       obj.TaskId(e.ExpressionId, e.Step),
+					Operation:    e.Operation,
+					Result:       e.Result,
+					ExpressionId: e.ExpressionId,
+					Step:         e.Step,
+					Exact:        e.Exact,
+				}
+			}
+		case obj.ClientResponse:
+			if expr, ok := m.expressions[e.Id]; ok {
+				expr.UserId = e.GetUserId()
+				// the time the expression was created at is kept by the repository
+				e.CreatedAt = expr.response.CreatedAt
+				expr.response = e
+			}
+			delete(m.steps, e.Id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
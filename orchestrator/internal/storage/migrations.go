@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration changes the schema of the database, migrations are applied in order of their versions
+type Migration struct {
+	Version int
+	Name    string
+	up      []string
+	down    []string
+}
+
+// MigrationStatus is the migration and the time it was applied at, zero if it is pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// legacyColumns were added to expressions on start before the migrations, databases of older versions may lack them
+var legacyColumns = []struct{ name, definition string }{
+	{"mode", "TEXT NOT NULL DEFAULT 'float'"},
+	{"decimal_result", "TEXT"},
+	{"priority", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// Migrator applies the migrations of the dialect and records them in the schema_migrations table
+type Migrator struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// OpenMigrator connects to the SQL database by DSN like Open without applying the migrations
+func OpenMigrator(ctx context.Context, dsn string) (*Migrator, error) {
+	switch {
+	case strings.HasPrefix(dsn, "memory://"):
+		return nil, fmt.Errorf("OpenMigrator: in-memory repository has no schema")
+	case dsn == "":
+		return nil, fmt.Errorf("OpenMigrator: empty DSN")
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		db, err := openPostgres(ctx, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("OpenMigrator: %w", err)
+		}
+		return &Migrator{db: db, dialect: postgresDialect}, nil
+	}
+	db, err := openSQLite(ctx, strings.TrimPrefix(dsn, "sqlite://"))
+	if err != nil {
+		return nil, fmt.Errorf("OpenMigrator: %w", err)
+	}
+	return &Migrator{db: db, dialect: sqliteDialect}, nil
+}
+
+// Up applies the pending migrations and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Up: %w", err)
+	}
+	var applied []Migration
+	for _, status := range statuses {
+		if !status.AppliedAt.IsZero() {
+			continue
+		}
+		if status.Version == 1 {
+			if err = m.upgradeLegacy(ctx); err != nil {
+				return applied, fmt.Errorf("Up: %w", err)
+			}
+		}
+		err = m.apply(ctx, status.up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			status.Version, status.Name, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return applied, fmt.Errorf("Up: migration %d %s: %w", status.Version, status.Name, err)
+		}
+		applied = append(applied, status.Migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the last applied migration and returns it, nil is returned if no migrations are applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Down: %w", err)
+	}
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].AppliedAt.IsZero() {
+			continue
+		}
+		migration := statuses[i].Migration
+		if err = m.apply(ctx, migration.down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+			return nil, fmt.Errorf("Down: migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, nil
+}
+
+// Status returns the migrations of the dialect in order of their versions
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if _, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations(version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL);"); err != nil {
+		return nil, fmt.Errorf("Status: %w", err)
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Status: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("Status: %w", err)
+		}
+		if applied[version], err = time.Parse(time.RFC3339, appliedAt); err != nil {
+			return nil, fmt.Errorf("Status: %w", err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Status: %w", err)
+	}
+	statuses := make([]MigrationStatus, 0, len(m.dialect.migrations))
+	for _, migration := range m.dialect.migrations {
+		statuses = append(statuses, MigrationStatus{Migration: migration, AppliedAt: applied[migration.Version]})
+	}
+	return statuses, nil
+}
+
+// Repository returns the Repository of the migrated database, it shares the connection with the migrator
+func (m *Migrator) Repository() Repository {
+	return &sqlRepository{db: m.db, dialect: m.dialect}
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// apply runs the statements of the migration and records it with the query in one transaction
+func (m *Migrator) apply(ctx context.Context, statements []string, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, m.dialect.query(record), args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgradeLegacy adds the columns missing from the expressions table of a database created before the migrations,
+// the first migration then creates only the tables that don't exist
+func (m *Migrator) upgradeLegacy(ctx context.Context) error {
+	var count int
+	if err := m.db.QueryRowContext(ctx, m.dialect.query(m.dialect.tableExists), "expressions").Scan(&count); err != nil {
+		return fmt.Errorf("upgradeLegacy: %w", err)
+	}
+	if count == 0 {
+		return nil
+	}
+	for _, column := range legacyColumns {
+		if err := m.db.QueryRowContext(ctx, m.dialect.query(m.dialect.columnExists), "expressions", column.name).Scan(&count); err != nil {
+			return fmt.Errorf("upgradeLegacy: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := m.db.ExecContext(ctx, "ALTER TABLE expressions ADD COLUMN "+column.name+" "+column.definition); err != nil {
+			return fmt.Errorf("upgradeLegacy: %w", err)
+		}
+	}
+	return nil
+}
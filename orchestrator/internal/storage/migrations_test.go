@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrator tests that migrations are applied once and rolled back in reverse order
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	migrator, err := OpenMigrator(ctx, "sqlite://"+filepath.Join(t.TempDir(), "store.db"))
+	assert.NoError(t, err)
+	defer migrator.Close()
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(sqliteDialect.migrations))
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.False(t, status.AppliedAt.IsZero())
+	}
+
+	for i := len(sqliteDialect.migrations) - 1; i >= 0; i-- {
+		migration, err := migrator.Down(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteDialect.migrations[i].Version, migration.Version)
+	}
+	migration, err := migrator.Down(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, migration)
+	var count int
+	assert.NoError(t, migrator.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'expressions'").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+// TestMigrator_LegacyDatabase tests that databases created before the migrations get the missing columns and keep their rows
+func TestMigrator_LegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	db, err := sql.Open("sqlite3", path)
+	assert.NoError(t, err)
+	for _, statement := range []string{
+		"CREATE TABLE users(id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT UNIQUE NOT NULL, password TEXT NOT NULL);",
+		"CREATE TABLE expressions(id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, expression TEXT NOT NULL, result REAL, status TEXT NOT NULL);",
+		"ALTER TABLE expressions ADD COLUMN mode TEXT NOT NULL DEFAULT 'float';",
+		"INSERT INTO users (login, password) VALUES ('user', 'password');",
+		"INSERT INTO expressions (user_id, expression, result, status) VALUES (1, '2 + 3', 5, 'Done');",
+	} {
+		_, err = db.Exec(statement)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.Close())
+
+	repo, err := Open(ctx, path)
+	assert.NoError(t, err)
+	defer repo.Close()
+	expr, err := repo.Expression(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Done", expr.Status)
+	assert.Equal(t, 5.0, expr.Result)
+	assert.Equal(t, "float", expr.Mode)
+	id, password, err := repo.User(ctx, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "password", password)
+}
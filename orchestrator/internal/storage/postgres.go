@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDriver is the database/sql driver of PostgreSQL registered by pgx
+const postgresDriver = "pgx"
+
+var postgresDialect = dialect{
+	numbered: true,
+	migrations: []Migration{
+		{
+			Version: 1,
+			Name:    "create users, expressions and expression_steps",
+			up: []string{
+				"CREATE TABLE IF NOT EXISTS users(id SERIAL PRIMARY KEY, login TEXT UNIQUE NOT NULL, password TEXT NOT NULL);",
+				"CREATE TABLE IF NOT EXISTS expressions(id SERIAL PRIMARY KEY, user_id INTEGER, expression TEXT NOT NULL, result DOUBLE PRECISION, status TEXT NOT NULL, mode TEXT NOT NULL DEFAULT 'float', decimal_result TEXT, priority INTEGER NOT NULL DEFAULT 0);",
+				"CREATE TABLE IF NOT EXISTS expression_steps(expression_id INTEGER NOT NULL, step INTEGER NOT NULL, operation TEXT NOT NULL, args TEXT NOT NULL, result DOUBLE PRECISION, decimal_result TEXT, PRIMARY KEY (expression_id, step));",
+			},
+			down: []string{
+				"DROP TABLE expression_steps;",
+				"DROP TABLE expressions;",
+				"DROP TABLE users;",
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add error, timestamps and operations to expressions",
+			up: []string{
+				"ALTER TABLE expressions ADD COLUMN error TEXT;",
+				"ALTER TABLE expressions ADD COLUMN created_at TIMESTAMPTZ;",
+				"ALTER TABLE expressions ADD COLUMN started_at TIMESTAMPTZ;",
+				"ALTER TABLE expressions ADD COLUMN finished_at TIMESTAMPTZ;",
+				"ALTER TABLE expressions ADD COLUMN operations INTEGER NOT NULL DEFAULT 0;",
+			},
+			down: []string{
+				"ALTER TABLE expressions DROP COLUMN operations;",
+				"ALTER TABLE expressions DROP COLUMN finished_at;",
+				"ALTER TABLE expressions DROP COLUMN started_at;",
+				"ALTER TABLE expressions DROP COLUMN created_at;",
+				"ALTER TABLE expressions DROP COLUMN error;",
+			},
+		},
+		{
+			Version: 3,
+			Name:    "create refresh_tokens",
+			up: []string{
+				"CREATE TABLE refresh_tokens(token_hash TEXT PRIMARY KEY, user_id INTEGER NOT NULL, expires_at BIGINT NOT NULL, used BOOLEAN NOT NULL DEFAULT FALSE);",
+				"CREATE INDEX refresh_tokens_user_id ON refresh_tokens(user_id);",
+			},
+			down: []string{
+				"DROP TABLE refresh_tokens;",
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add owner and heartbeat to expressions",
+			up: []string{
+				"ALTER TABLE expressions ADD COLUMN owner TEXT;",
+				"ALTER TABLE expressions ADD COLUMN heartbeat_at BIGINT;",
+			},
+			down: []string{
+				"ALTER TABLE expressions DROP COLUMN heartbeat_at;",
+				"ALTER TABLE expressions DROP COLUMN owner;",
+			},
+		},
+	},
+	tableExists:  "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?",
+	columnExists: "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?",
+	// errors of the driver report SQLSTATE, 23505 is unique_violation
+	duplicate: func(err error) bool {
+		var stateErr interface{ SQLState() string }
+		return errors.As(err, &stateErr) && stateErr.SQLState() == "23505"
+	},
+}
+
+// NewPostgres returns the Repository of the PostgreSQL database, its schema has to be migrated
+func NewPostgres(db *sql.DB) Repository {
+	return &sqlRepository{db: db, dialect: postgresDialect}
+}
+
+// openPostgres connects to the PostgreSQL database
+func openPostgres(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(postgresDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("openPostgres: %w", err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("openPostgres: %w", err)
+	}
+	return db, nil
+}
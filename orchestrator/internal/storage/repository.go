@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	obj "orchestrator/internal/entities"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested row doesn't exist or belongs to another user
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when the user with the login already exists
+	ErrDuplicate = errors.New("already exists")
+)
+
+// Repository stores users, expressions and the computed steps of expressions
+type Repository interface {
+	// CreateUser adds the user with the password hash and returns its id
+	CreateUser(ctx context.Context, login string, password string) (int, error)
+	// User returns the id and the stored password of the user with the login,
+	// the password is a hash or the plaintext of users registered before passwords were hashed
+	User(ctx context.Context, login string) (int, string, error)
+	// SetPassword replaces the stored password of the user
+	SetPassword(ctx context.Context, id int, password string) error
+	// CreateRefreshToken stores the hash of the refresh token of the user, the expired tokens of the user are deleted
+	CreateRefreshToken(ctx context.Context, userId int, hash string, expiresAt time.Time) error
+	// UseRefreshToken marks the refresh token used and returns its user, ErrNotFound is returned for unknown and expired tokens.
+	// A token that was used before has been stolen, so all refresh tokens of its user are revoked and ErrNotFound is returned
+	UseRefreshToken(ctx context.Context, hash string, now time.Time) (int, error)
+	// CreateExpression adds the expression in progress and returns its id
+	CreateExpression(ctx context.Context, expr obj.Expression) (int, error)
+	// Expressions returns the expressions of the user
+	Expressions(ctx context.Context, userId int) ([]obj.ClientResponse, error)
+	// Expression returns the expression of the user by id
+	Expression(ctx context.Context, userId int, id int) (obj.ClientResponse, error)
+	// Unfinished claims the expressions in progress for the owner and returns them, they are evaluated again.
+	// Only expressions without an owner or whose owner hasn't sent a heartbeat since expiredBefore are claimed,
+	// a row is claimed by one replica even if several replicas claim expressions at once
+	Unfinished(ctx context.Context, owner string, expiredBefore time.Time) ([]obj.Expression, error)
+	// Heartbeat keeps the expressions in progress of the owner from being claimed by other replicas
+	Heartbeat(ctx context.Context, owner string, now time.Time) error
+	// CompletedSteps returns the computed steps of the expressions in progress by expression id and step number
+	CompletedSteps(ctx context.Context) (map[int]map[int]obj.StepResult, error)
+	// Write stores computed steps (obj.StepResult) and finished expressions (obj.ClientResponse) in one transaction,
+	// the steps of finished expressions are deleted
+	Write(ctx context.Context, batch []interface{}) error
+	Close() error
+}
+
+// Open opens the repository by DSN: postgres:// and postgresql:// URLs are PostgreSQL databases,
+// memory:// is an in-memory repository and any other DSN is a SQLite file with an optional sqlite:// prefix.
+// The pending migrations of SQL databases are applied
+func Open(ctx context.Context, dsn string) (Repository, error) {
+	if strings.HasPrefix(dsn, "memory://") {
+		return NewMemory(), nil
+	}
+	migrator, err := OpenMigrator(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		_ = migrator.Close()
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	return migrator.Repository(), nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	obj "orchestrator/internal/entities"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRepositories tests that the backends store users, expressions and steps the same way
+func TestRepositories(t *testing.T) {
+	ctx := context.Background()
+	sqlite, err := Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "store.db"))
+	assert.NoError(t, err)
+	memory, err := Open(ctx, "memory://")
+	assert.NoError(t, err)
+
+	for name, repo := range map[string]Repository{"sqlite": sqlite, "memory": memory} {
+		t.Run(name, func(t *testing.T) {
+			defer repo.Close()
+			userId, err := repo.CreateUser(ctx, "user", "password")
+			assert.NoError(t, err)
+			_, err = repo.CreateUser(ctx, "user", "password")
+			assert.ErrorIs(t, err, ErrDuplicate)
+			found, password, err := repo.User(ctx, "user")
+			assert.NoError(t, err)
+			assert.Equal(t, userId, found)
+			assert.Equal(t, "password", password)
+			_, _, err = repo.User(ctx, "unknown")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.NoError(t, repo.SetPassword(ctx, userId, "hash"))
+			_, password, err = repo.User(ctx, "user")
+			assert.NoError(t, err)
+			assert.Equal(t, "hash", password)
+			assert.ErrorIs(t, repo.SetPassword(ctx, userId+1, "hash"), ErrNotFound)
+
+			created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+			id, err := repo.CreateExpression(ctx, obj.Expression{UserId: userId, Expression: "(1 + 2) * 3", Mode: obj.ModeDecimal, Priority: 2, CreatedAt: created, Owner: "first"})
+			assert.NoError(t, err)
+			// the expression is claimed only after its owner stops sending heartbeats
+			unfinished, err := repo.Unfinished(ctx, "second", time.Now().Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Empty(t, unfinished)
+			unfinished, err = repo.Unfinished(ctx, "first", time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Empty(t, unfinished)
+			unfinished, err = repo.Unfinished(ctx, "second", time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, []obj.Expression{{Id: id, UserId: userId, Expression: "(1 + 2) * 3", Mode: obj.ModeDecimal, Priority: 2, CreatedAt: created, Owner: "second"}}, unfinished)
+			assert.NoError(t, repo.Heartbeat(ctx, "second", time.Now().Add(2*time.Hour)))
+			unfinished, err = repo.Unfinished(ctx, "third", time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Empty(t, unfinished)
+
+			step := obj.StepResult{ExpressionId: id, Step: 1, Operation: "+", Args: []string{"1", "2"}, Result: 3, Exact: "3"}
+			assert.NoError(t, repo.Write(ctx, []interface{}{step, step}))
+			steps, err := repo.CompletedSteps(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, map[int]map[int]obj.StepResult{id: {1: {TaskId: obj.TaskId(id, 1), ExpressionId: id, Step: 1, Operation: "+", Result: 3, Exact: "3"}}}, steps)
+
+			started, finished := created.Add(time.Second), created.Add(2*time.Second)
+			expr := obj.ClientResponse{Id: id, Status: "Done", Result: 9, Mode: obj.ModeDecimal, Decimal: "9", Operations: 2, StartedAt: &started, FinishedAt: &finished}
+			expr.SetUserId(userId)
+			assert.NoError(t, repo.Write(ctx, []interface{}{expr}))
+			expr.CreatedAt = &created
+			stored, err := repo.Expression(ctx, userId, id)
+			assert.NoError(t, err)
+			assert.Equal(t, expr, stored)
+			expressions, err := repo.Expressions(ctx, userId)
+			assert.NoError(t, err)
+			assert.Equal(t, []obj.ClientResponse{expr}, expressions)
+			_, err = repo.Expression(ctx, userId+1, id)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// the finished expression is not evaluated again and its steps are deleted
+			unfinished, err = repo.Unfinished(ctx, "third", time.Now().Add(3*time.Hour))
+			assert.NoError(t, err)
+			assert.Empty(t, unfinished)
+			steps, err = repo.CompletedSteps(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, steps)
+
+			now := time.Now()
+			assert.NoError(t, repo.CreateRefreshToken(ctx, userId, "first", now.Add(time.Hour)))
+			assert.NoError(t, repo.CreateRefreshToken(ctx, userId, "second", now.Add(time.Hour)))
+			assert.NoError(t, repo.CreateRefreshToken(ctx, userId, "expired", now.Add(-time.Hour)))
+			_, err = repo.UseRefreshToken(ctx, "expired", now)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.UseRefreshToken(ctx, "unknown", now)
+			assert.ErrorIs(t, err, ErrNotFound)
+			owner, err := repo.UseRefreshToken(ctx, "first", now)
+			assert.NoError(t, err)
+			assert.Equal(t, userId, owner)
+			// the reused token revokes the other tokens of the user
+			_, err = repo.UseRefreshToken(ctx, "first", now)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.UseRefreshToken(ctx, "second", now)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+// TestPostgres_Placeholders tests that queries to PostgreSQL use numbered placeholders
+func TestPostgres_Placeholders(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	repo := NewPostgres(db)
+	defer repo.Close()
+	mock.ExpectQuery("SELECT "+responseColumns+" FROM expressions WHERE user_id = $1 AND id = $2").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows(strings.Split(responseColumns, ", ")))
+
+	_, err = repo.Expression(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// stateError is an error of the PostgreSQL driver with SQLSTATE
+type stateError string
+
+func (e stateError) Error() string    { return "state " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+// TestPostgres_Duplicate tests that unique violations of PostgreSQL are reported as ErrDuplicate
+func TestPostgres_Duplicate(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	repo := NewPostgres(db)
+	defer repo.Close()
+	mock.ExpectQuery("INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id").
+		WithArgs("user", "hash").
+		WillReturnError(stateError("23505"))
+
+	_, err = repo.CreateUser(context.Background(), "user", "hash")
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	obj "orchestrator/internal/entities"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect contains the differences of the SQL databases
+type dialect struct {
+	// numbered is true if placeholders are $1, $2... instead of ?
+	numbered bool
+	// migrations create the schema of the database
+	migrations []Migration
+	// tableExists counts the tables with the name, columnExists counts the columns of the table with the name
+	tableExists  string
+	columnExists string
+	// duplicate reports whether the error is a violation of a unique constraint
+	duplicate func(err error) bool
+}
+
+// sqlRepository is the Repository of a SQL database, queries are written with ? placeholders
+type sqlRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// query rewrites the placeholders of the query for the dialect
+func (d dialect) query(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+func (r *sqlRepository) CreateUser(ctx context.Context, login string, password string) (int, error) {
+	var id int
+	row := r.db.QueryRowContext(ctx, r.dialect.query("INSERT INTO users (login, password) VALUES (?, ?) RETURNING id"), login, password)
+	if err := row.Scan(&id); err != nil {
+		if r.dialect.duplicate(err) {
+			err = ErrDuplicate
+		}
+		return 0, fmt.Errorf("CreateUser: %w", err)
+	}
+	return id, nil
+}
+
+func (r *sqlRepository) User(ctx context.Context, login string) (int, string, error) {
+	var id int
+	var password string
+	row := r.db.QueryRowContext(ctx, r.dialect.query("SELECT id, password FROM users WHERE login = ?"), login)
+	if err := row.Scan(&id, &password); err != nil {
+		return 0, "", fmt.Errorf("User: %w", notFound(err))
+	}
+	return id, password, nil
+}
+
+func (r *sqlRepository) SetPassword(ctx context.Context, id int, password string) error {
+	result, err := r.db.ExecContext(ctx, r.dialect.query("UPDATE users SET password = ? WHERE id = ?"), password, id)
+	if err != nil {
+		return fmt.Errorf("SetPassword: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("SetPassword: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *sqlRepository) CreateRefreshToken(ctx context.Context, userId int, hash string, expiresAt time.Time) error {
+	if _, err := r.db.ExecContext(ctx, r.dialect.query("DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at <= ?"), userId, time.Now().Unix()); err != nil {
+		return fmt.Errorf("CreateRefreshToken: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, r.dialect.query("INSERT INTO refresh_tokens (token_hash, user_id, expires_at) VALUES (?, ?, ?)"), hash, userId, expiresAt.Unix()); err != nil {
+		return fmt.Errorf("CreateRefreshToken: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlRepository) UseRefreshToken(ctx context.Context, hash string, now time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("UseRefreshToken: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var userId int
+	var expiresAt int64
+	var used bool
+	row := tx.QueryRowContext(ctx, r.dialect.query("SELECT user_id, expires_at, used FROM refresh_tokens WHERE token_hash = ?"), hash)
+	if err = row.Scan(&userId, &expiresAt, &used); err != nil {
+		return 0, fmt.Errorf("UseRefreshToken: %w", notFound(err))
+	}
+	if used {
+		if _, err = tx.ExecContext(ctx, r.dialect.query("DELETE FROM refresh_tokens WHERE user_id = ?"), userId); err != nil {
+			return 0, fmt.Errorf("UseRefreshToken: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, fmt.Errorf("UseRefreshToken: %w", err)
+		}
+		return 0, fmt.Errorf("UseRefreshToken: token was used before: %w", ErrNotFound)
+	}
+	if expiresAt <= now.Unix() {
+		return 0, fmt.Errorf("UseRefreshToken: token expired: %w", ErrNotFound)
+	}
+	// the token may be used by a concurrent request after it was read
+	result, err := tx.ExecContext(ctx, r.dialect.query("UPDATE refresh_tokens SET used = ? WHERE token_hash = ? AND used = ?"), true, hash, false)
+	if err != nil {
+		return 0, fmt.Errorf("UseRefreshToken: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return 0, fmt.Errorf("UseRefreshToken: token was used before: %w", ErrNotFound)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("UseRefreshToken: %w", err)
+	}
+	return userId, nil
+}
+
+func (r *sqlRepository) CreateExpression(ctx context.Context, expr obj.Expression) (int, error) {
+	var id int
+	var created *time.Time
+	if !expr.CreatedAt.IsZero() {
+		created = utc(&expr.CreatedAt)
+	}
+	row := r.db.QueryRowContext(ctx, r.dialect.query("INSERT INTO expressions (user_id, expression, status, mode, priority, created_at, owner, heartbeat_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+		expr.UserId, expr.Expression, "In progress", expr.Mode, expr.Priority, created, expr.Owner, time.Now().UnixMilli())
+	if err := row.Scan(&id); err != nil {
+		return 0, fmt.Errorf("CreateExpression: %w", err)
+	}
+	return id, nil
+}
+
+func (r *sqlRepository) Expressions(ctx context.Context, userId int) ([]obj.ClientResponse, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.query("SELECT id, "+responseColumns+" FROM expressions WHERE user_id = ?"), userId)
+	if err != nil {
+		return nil, fmt.Errorf("Expressions: %w", err)
+	}
+	defer rows.Close()
+	var expressions []obj.ClientResponse
+	for rows.Next() {
+		var id int
+		expr, err := scanResponse(rows, userId, &id)
+		if err != nil {
+			return nil, fmt.Errorf("Expressions: %w", err)
+		}
+		expr.Id = id
+		expressions = append(expressions, expr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Expressions: %w", err)
+	}
+	return expressions, nil
+}
+
+func (r *sqlRepository) Expression(ctx context.Context, userId int, id int) (obj.ClientResponse, error) {
+	row := r.db.QueryRowContext(ctx, r.dialect.query("SELECT "+responseColumns+" FROM expressions WHERE user_id = ? AND id = ?"), userId, id)
+	expr, err := scanResponse(row, userId)
+	if err != nil {
+		return obj.ClientResponse{}, fmt.Errorf("Expression: %w", notFound(err))
+	}
+	expr.Id = id
+	return expr, nil
+}
+
+// responseColumns are the columns of the expression sent to the client, they are read by scanResponse
+const responseColumns = "result, status, mode, decimal_result, error, operations, created_at, started_at, finished_at"
+
+// scanResponse reads responseColumns of the expression of the user, columns before them are read into dest
+func scanResponse(row interface{ Scan(...interface{}) error }, userId int, dest ...interface{}) (obj.ClientResponse, error) {
+	var expr obj.ClientResponse
+	var result sql.NullFloat64
+	var decimal, errorText sql.NullString
+	var created, started, finished sql.NullTime
+	dest = append(dest, &result, &expr.Status, &expr.Mode, &decimal, &errorText, &expr.Operations, &created, &started, &finished)
+	if err := row.Scan(dest...); err != nil {
+		return obj.ClientResponse{}, err
+	}
+	expr.Result, expr.Decimal, expr.Error = result.Float64, decimal.String, errorText.String
+	expr.CreatedAt, expr.StartedAt, expr.FinishedAt = timePointer(created), timePointer(started), timePointer(finished)
+	expr.SetUserId(userId)
+	return expr, nil
+}
+
+// timePointer returns nil for NULL
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (r *sqlRepository) Unfinished(ctx context.Context, owner string, expiredBefore time.Time) ([]obj.Expression, error) {
+	// the rows are claimed by one statement, so a concurrent claim of another replica doesn't match them anymore
+	rows, err := r.db.QueryContext(ctx, r.dialect.query("UPDATE expressions SET owner = ?, heartbeat_at = ? WHERE status = ? AND (owner IS NULL OR owner = '' OR owner <> ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)) RETURNING id, user_id, expression, mode, priority, created_at"),
+		owner, time.Now().UnixMilli(), "In progress", owner, expiredBefore.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("Unfinished: %w", err)
+	}
+	defer rows.Close()
+	var expressions []obj.Expression
+	for rows.Next() {
+		var expr obj.Expression
+		var created sql.NullTime
+		if err = rows.Scan(&expr.Id, &expr.UserId, &expr.Expression, &expr.Mode, &expr.Priority, &created); err != nil {
+			return nil, fmt.Errorf("Unfinished: %w", err)
+		}
+		expr.CreatedAt, expr.Owner = created.Time, owner
+		expressions = append(expressions, expr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Unfinished: %w", err)
+	}
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].Id < expressions[j].Id })
+	return expressions, nil
+}
+
+func (r *sqlRepository) Heartbeat(ctx context.Context, owner string, now time.Time) error {
+	if _, err := r.db.ExecContext(ctx, r.dialect.query("UPDATE expressions SET heartbeat_at = ? WHERE owner = ? AND status = ?"), now.UnixMilli(), owner, "In progress"); err != nil {
+		return fmt.Errorf("Heartbeat: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlRepository) CompletedSteps(ctx context.Context) (map[int]map[int]obj.StepResult, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.query("SELECT expression_id, step, operation, result, decimal_result FROM expression_steps WHERE expression_id IN (SELECT id FROM expressions WHERE status = ?)"), "In progress")
+	if err != nil {
+		return nil, fmt.Errorf("CompletedSteps: %w", err)
+	}
+	defer rows.Close()
+	steps := make(map[int]map[int]obj.StepResult)
+	for rows.Next() {
+		var step obj.StepResult
+		var result sql.NullFloat64
+		var exact sql.NullString
+		if err = rows.Scan(&step.ExpressionId, &step.Step, &step.Operation, &result, &exact); err != nil {
+			return nil, fmt.Errorf("CompletedSteps: %w", err)
+		}
+		step.TaskId = obj.TaskId(step.ExpressionId, step.Step)
+		step.Result, step.Exact = result.Float64, exact.String
+		if steps[step.ExpressionId] == nil {
+			steps[step.ExpressionId] = make(map[int]obj.StepResult)
+		}
+		steps[step.ExpressionId][step.Step] = step
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("CompletedSteps: %w", err)
+	}
+	return steps, nil
+}
+
+func (r *sqlRepository) Write(ctx context.Context, batch []interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	for _, element := range batch {
+		if err = r.write(ctx, tx, element); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("Write: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	return nil
+}
+
+// write writes the element of the batch in the transaction
+func (r *sqlRepository) write(ctx context.Context, tx *sql.Tx, element interface{}) error {
+	switch e := element.(type) {
+	case obj.StepResult:
+		args, err := json.Marshal(e.Args)
+		if err != nil {
+			return err
+		}
+		var exact sql.NullString
+		if e.Exact != "" {
+			exact = sql.NullString{String: e.Exact, Valid: true}
+		}
+		_, err = tx.ExecContext(ctx, r.dialect.query("INSERT INTO expression_steps (expression_id, step, operation, args, result, decimal_result) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (expression_id, step) DO NOTHING"),
+			e.ExpressionId, e.Step, e.Operation, string(args), e.Result, exact)
+		return err
+	case obj.ClientResponse:
+		if _, err := tx.ExecContext(ctx, r.dialect.query("UPDATE expressions SET user_id = ?, result = ?, status = ?, decimal_result = ?, error = ?, operations = ?, started_at = ?, finished_at = ? WHERE id = ?"),
+			e.GetUserId(), e.Result, e.Status, e.Decimal, e.Error, e.Operations, utc(e.StartedAt), utc(e.FinishedAt), e.Id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, r.dialect.query("DELETE FROM expression_steps WHERE expression_id = ?"), e.Id)
+		return err
+	}
+	return fmt.Errorf("unexpected element %T", element)
+}
+
+func (r *sqlRepository) Close() error {
+	return r.db.Close()
+}
+
+// utc returns the time in UTC, so all rows are stored in one time zone
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// notFound replaces sql.ErrNoRows with ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
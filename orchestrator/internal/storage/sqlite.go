@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = dialect{
+	migrations: []Migration{
+		{
+			Version: 1,
+			Name:    "create users, expressions and expression_steps",
+			up: []string{
+				"CREATE TABLE IF NOT EXISTS users(id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT UNIQUE NOT NULL, password TEXT NOT NULL);",
+				"CREATE TABLE IF NOT EXISTS expressions(id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER, expression TEXT NOT NULL, result REAL, status TEXT NOT NULL, mode TEXT NOT NULL DEFAULT 'float', decimal_result TEXT, priority INTEGER NOT NULL DEFAULT 0);",
+				"CREATE TABLE IF NOT EXISTS expression_steps(expression_id INTEGER NOT NULL, step INTEGER NOT NULL, operation TEXT NOT NULL, args TEXT NOT NULL, result REAL, decimal_result TEXT, PRIMARY KEY (expression_id, step));",
+			},
+			down: []string{
+				"DROP TABLE expression_steps;",
+				"DROP TABLE expressions;",
+				"DROP TABLE users;",
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add error, timestamps and operations to expressions",
+			up: []string{
+				"ALTER TABLE expressions ADD COLUMN error TEXT;",
+				"ALTER TABLE expressions ADD COLUMN created_at TIMESTAMP;",
+				"ALTER TABLE expressions ADD COLUMN started_at TIMESTAMP;",
+				"ALTER TABLE expressions ADD COLUMN finished_at TIMESTAMP;",
+				"ALTER TABLE expressions ADD COLUMN operations INTEGER NOT NULL DEFAULT 0;",
+			},
+			down: []string{
+				"ALTER TABLE expressions DROP COLUMN operations;",
+				"ALTER TABLE expressions DROP COLUMN finished_at;",
+				"ALTER TABLE expressions DROP COLUMN started_at;",
+				"ALTER TABLE expressions DROP COLUMN created_at;",
+				"ALTER TABLE expressions DROP COLUMN error;",
+			},
+		},
+		{
+			Version: 3,
+			Name:    "create refresh_tokens",
+			up: []string{
+				"CREATE TABLE refresh_tokens(token_hash TEXT PRIMARY KEY, user_id INTEGER NOT NULL, expires_at INTEGER NOT NULL, used BOOLEAN NOT NULL DEFAULT FALSE);",
+				"CREATE INDEX refresh_tokens_user_id ON refresh_tokens(user_id);",
+			},
+			down: []string{
+				"DROP TABLE refresh_tokens;",
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add owner and heartbeat to expressions",
+			up: []string{
+				"ALTER TABLE expressions ADD COLUMN owner TEXT;",
+				"ALTER TABLE expressions ADD COLUMN heartbeat_at INTEGER;",
+			},
+			down: []string{
+				"ALTER TABLE expressions DROP COLUMN heartbeat_at;",
+				"ALTER TABLE expressions DROP COLUMN owner;",
+			},
+		},
+	},
+	tableExists:  "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+	columnExists: "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?",
+	duplicate: func(err error) bool {
+		var sqliteErr sqlite3.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	},
+}
+
+// NewSQLite returns the Repository of the SQLite database, its schema has to be migrated
+func NewSQLite(db *sql.DB) Repository {
+	return &sqlRepository{db: db, dialect: sqliteDialect}
+}
+
+// openSQLite opens the SQLite file
+func openSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("openSQLite: %w", err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("openSQLite: %w", err)
+	}
+	return db, nil
+}
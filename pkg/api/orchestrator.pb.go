@@ -58,12 +58,18 @@ func (*GetTaskRequest) Descriptor() ([]byte, []int) {
 }
 
 type GetTaskResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Arg1          float32                `protobuf:"fixed32,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
-	Arg2          float32                `protobuf:"fixed32,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
-	Operation     string                 `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
-	OperationTime int32                  `protobuf:"varint,5,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the id of the expression the task belongs to
+	Id int32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// arg1 and arg2 duplicate the first two args for agents that don't read args yet
+	Arg1 float32 `protobuf:"fixed32,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Arg2 float32 `protobuf:"fixed32,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	// operation is an operator (+, -, *, /, ^, %, //, ~) or a function name (sqrt, max, ...)
+	Operation     string    `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
+	OperationTime int32     `protobuf:"varint,5,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
+	Args          []float32 `protobuf:"fixed32,6,rep,packed,name=args,proto3" json:"args,omitempty"`
+	// task_id identifies the operation within the expression, results are matched to operations by it
+	TaskId        string `protobuf:"bytes,7,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -133,10 +139,25 @@ func (x *GetTaskResponse) GetOperationTime() int32 {
 	return 0
 }
 
+func (x *GetTaskResponse) GetArgs() []float32 {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
 type PostTaskRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
 	Result        float32                `protobuf:"fixed32,2,opt,name=result,proto3" json:"result,omitempty"`
+	TaskId        string                 `protobuf:"bytes,3,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -185,6 +206,13 @@ func (x *PostTaskRequest) GetResult() float32 {
 	return 0
 }
 
+func (x *PostTaskRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
 type PostTaskResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -221,25 +249,243 @@ func (*PostTaskResponse) Descriptor() ([]byte, []int) {
 	return file_orchestrator_proto_rawDescGZIP(), []int{3}
 }
 
+type FailTaskRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Id     int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TaskId string                 `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	// error is the reason the agent could not compute the task, the expression fails with it
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailTaskRequest) Reset() {
+	*x = FailTaskRequest{}
+	mi := &file_orchestrator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailTaskRequest) ProtoMessage() {}
+
+func (x *FailTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailTaskRequest.ProtoReflect.Descriptor instead.
+func (*FailTaskRequest) Descriptor() ([]byte, []int) {
+	return file_orchestrator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FailTaskRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *FailTaskRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *FailTaskRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type FailTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailTaskResponse) Reset() {
+	*x = FailTaskResponse{}
+	mi := &file_orchestrator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailTaskResponse) ProtoMessage() {}
+
+func (x *FailTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailTaskResponse.ProtoReflect.Descriptor instead.
+func (*FailTaskResponse) Descriptor() ([]byte, []int) {
+	return file_orchestrator_proto_rawDescGZIP(), []int{5}
+}
+
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// credits is the number of tasks the agent is ready to take in addition to the ones already sent to it
+	Credits       int32            `protobuf:"varint,1,opt,name=credits,proto3" json:"credits,omitempty"`
+	Result        *PostTaskRequest `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	Failure       *FailTaskRequest `protobuf:"bytes,3,opt,name=failure,proto3" json:"failure,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_orchestrator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_orchestrator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AgentMessage) GetCredits() int32 {
+	if x != nil {
+		return x.Credits
+	}
+	return 0
+}
+
+func (x *AgentMessage) GetResult() *PostTaskRequest {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetFailure() *FailTaskRequest {
+	if x != nil {
+		return x.Failure
+	}
+	return nil
+}
+
+type TaskAssignment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Task          *GetTaskResponse       `protobuf:"bytes,1,opt,name=task,proto3" json:"task,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskAssignment) Reset() {
+	*x = TaskAssignment{}
+	mi := &file_orchestrator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskAssignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskAssignment) ProtoMessage() {}
+
+func (x *TaskAssignment) ProtoReflect() protoreflect.Message {
+	mi := &file_orchestrator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskAssignment.ProtoReflect.Descriptor instead.
+func (*TaskAssignment) Descriptor() ([]byte, []int) {
+	return file_orchestrator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TaskAssignment) GetTask() *GetTaskResponse {
+	if x != nil {
+		return x.Task
+	}
+	return nil
+}
+
 var File_orchestrator_proto protoreflect.FileDescriptor
 
 const file_orchestrator_proto_rawDesc = "" +
 	"\n" +
 	"\x12orchestrator.proto\x12\x03api\"\x10\n" +
-	"\x0eGetTaskRequest\"\x8e\x01\n" +
+	"\x0eGetTaskRequest\"\xbb\x01\n" +
 	"\x0fGetTaskResponse\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
 	"\x04arg1\x18\x02 \x01(\x02R\x04arg1\x12\x12\n" +
 	"\x04arg2\x18\x03 \x01(\x02R\x04arg2\x12\x1c\n" +
 	"\toperation\x18\x04 \x01(\tR\toperation\x12%\n" +
-	"\x0eoperation_time\x18\x05 \x01(\x05R\roperationTime\"9\n" +
+	"\x0eoperation_time\x18\x05 \x01(\x05R\roperationTime\x12\x12\n" +
+	"\x04args\x18\x06 \x03(\x02R\x04args\x12\x17\n" +
+	"\atask_id\x18\a \x01(\tR\x06taskId\"R\n" +
 	"\x0fPostTaskRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x16\n" +
-	"\x06result\x18\x02 \x01(\x02R\x06result\"\x12\n" +
-	"\x10PostTaskResponse2}\n" +
+	"\x06result\x18\x02 \x01(\x02R\x06result\x12\x17\n" +
+	"\atask_id\x18\x03 \x01(\tR\x06taskId\"\x12\n" +
+	"\x10PostTaskResponse\"P\n" +
+	"\x0fFailTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x12\n" +
+	"\x10FailTaskResponse\"\x86\x01\n" +
+	"\fAgentMessage\x12\x18\n" +
+	"\acredits\x18\x01 \x01(\x05R\acredits\x12,\n" +
+	"\x06result\x18\x02 \x01(\v2\x14.api.PostTaskRequestR\x06result\x12.\n" +
+	"\afailure\x18\x03 \x01(\v2\x14.api.FailTaskRequestR\afailure\":\n" +
+	"\x0eTaskAssignment\x12(\n" +
+	"\x04task\x18\x01 \x01(\v2\x14.api.GetTaskResponseR\x04task2\xea\x01\n" +
 	"\fOrchestrator\x124\n" +
 	"\aGetTask\x12\x13.api.GetTaskRequest\x1a\x14.api.GetTaskResponse\x127\n" +
-	"\bPostTask\x12\x14.api.PostTaskRequest\x1a\x15.api.PostTaskResponseB\tZ\apkg/apib\x06proto3"
+	"\bPostTask\x12\x14.api.PostTaskRequest\x1a\x15.api.PostTaskResponse\x127\n" +
+	"\bFailTask\x12\x14.api.FailTaskRequest\x1a\x15.api.FailTaskResponse\x122\n" +
+	"\x04Work\x12\x11.api.AgentMessage\x1a\x13.api.TaskAssignment(\x010\x01B\tZ\apkg/apib\x06proto3"
 
 var (
 	file_orchestrator_proto_rawDescOnce sync.Once
@@ -253,23 +499,34 @@ func file_orchestrator_proto_rawDescGZIP() []byte {
 	return file_orchestrator_proto_rawDescData
 }
 
-var file_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_orchestrator_proto_goTypes = []any{
 	(*GetTaskRequest)(nil),   // 0: api.GetTaskRequest
 	(*GetTaskResponse)(nil),  // 1: api.GetTaskResponse
 	(*PostTaskRequest)(nil),  // 2: api.PostTaskRequest
 	(*PostTaskResponse)(nil), // 3: api.PostTaskResponse
+	(*FailTaskRequest)(nil),  // 4: api.FailTaskRequest
+	(*FailTaskResponse)(nil), // 5: api.FailTaskResponse
+	(*AgentMessage)(nil),     // 6: api.AgentMessage
+	(*TaskAssignment)(nil),   // 7: api.TaskAssignment
 }
 var file_orchestrator_proto_depIdxs = []int32{
-	0, // 0: api.Orchestrator.GetTask:input_type -> api.GetTaskRequest
-	2, // 1: api.Orchestrator.PostTask:input_type -> api.PostTaskRequest
-	1, // 2: api.Orchestrator.GetTask:output_type -> api.GetTaskResponse
-	3, // 3: api.Orchestrator.PostTask:output_type -> api.PostTaskResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	2, // 0: api.AgentMessage.result:type_name -> api.PostTaskRequest
+	4, // 1: api.AgentMessage.failure:type_name -> api.FailTaskRequest
+	1, // 2: api.TaskAssignment.task:type_name -> api.GetTaskResponse
+	0, // 3: api.Orchestrator.GetTask:input_type -> api.GetTaskRequest
+	2, // 4: api.Orchestrator.PostTask:input_type -> api.PostTaskRequest
+	4, // 5: api.Orchestrator.FailTask:input_type -> api.FailTaskRequest
+	6, // 6: api.Orchestrator.Work:input_type -> api.AgentMessage
+	1, // 7: api.Orchestrator.GetTask:output_type -> api.GetTaskResponse
+	3, // 8: api.Orchestrator.PostTask:output_type -> api.PostTaskResponse
+	5, // 9: api.Orchestrator.FailTask:output_type -> api.FailTaskResponse
+	7, // 10: api.Orchestrator.Work:output_type -> api.TaskAssignment
+	7, // [7:11] is the sub-list for method output_type
+	3, // [3:7] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_orchestrator_proto_init() }
@@ -283,7 +540,7 @@ func file_orchestrator_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_orchestrator_proto_rawDesc), len(file_orchestrator_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
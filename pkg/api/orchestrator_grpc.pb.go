@@ -21,6 +21,8 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	Orchestrator_GetTask_FullMethodName  = "/api.Orchestrator/GetTask"
 	Orchestrator_PostTask_FullMethodName = "/api.Orchestrator/PostTask"
+	Orchestrator_FailTask_FullMethodName = "/api.Orchestrator/FailTask"
+	Orchestrator_Work_FullMethodName     = "/api.Orchestrator/Work"
 )
 
 // OrchestratorClient is the client API for Orchestrator service.
@@ -29,6 +31,9 @@ const (
 type OrchestratorClient interface {
 	GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*GetTaskResponse, error)
 	PostTask(ctx context.Context, in *PostTaskRequest, opts ...grpc.CallOption) (*PostTaskResponse, error)
+	FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*FailTaskResponse, error)
+	// Work streams tasks to the agent as soon as they are enqueued, never more than the agent has credits for
+	Work(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, TaskAssignment], error)
 }
 
 type orchestratorClient struct {
@@ -59,12 +64,38 @@ func (c *orchestratorClient) PostTask(ctx context.Context, in *PostTaskRequest,
 	return out, nil
 }
 
+func (c *orchestratorClient) FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*FailTaskResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FailTaskResponse)
+	err := c.cc.Invoke(ctx, Orchestrator_FailTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) Work(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, TaskAssignment], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Orchestrator_ServiceDesc.Streams[0], Orchestrator_Work_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentMessage, TaskAssignment]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Orchestrator_WorkClient = grpc.BidiStreamingClient[AgentMessage, TaskAssignment]
+
 // OrchestratorServer is the server API for Orchestrator service.
 // All implementations must embed UnimplementedOrchestratorServer
 // for forward compatibility.
 type OrchestratorServer interface {
 	GetTask(context.Context, *GetTaskRequest) (*GetTaskResponse, error)
 	PostTask(context.Context, *PostTaskRequest) (*PostTaskResponse, error)
+	FailTask(context.Context, *FailTaskRequest) (*FailTaskResponse, error)
+	// Work streams tasks to the agent as soon as they are enqueued, never more than the agent has credits for
+	Work(grpc.BidiStreamingServer[AgentMessage, TaskAssignment]) error
 	mustEmbedUnimplementedOrchestratorServer()
 }
 
@@ -81,6 +112,12 @@ func (UnimplementedOrchestratorServer) GetTask(context.Context, *GetTaskRequest)
 func (UnimplementedOrchestratorServer) PostTask(context.Context, *PostTaskRequest) (*PostTaskResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PostTask not implemented")
 }
+func (UnimplementedOrchestratorServer) FailTask(context.Context, *FailTaskRequest) (*FailTaskResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FailTask not implemented")
+}
+func (UnimplementedOrchestratorServer) Work(grpc.BidiStreamingServer[AgentMessage, TaskAssignment]) error {
+	return status.Errorf(codes.Unimplemented, "method Work not implemented")
+}
 func (UnimplementedOrchestratorServer) mustEmbedUnimplementedOrchestratorServer() {}
 func (UnimplementedOrchestratorServer) testEmbeddedByValue()                      {}
 
@@ -138,6 +175,31 @@ func _Orchestrator_PostTask_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Orchestrator_FailTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).FailTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Orchestrator_FailTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).FailTask(ctx, req.(*FailTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_Work_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OrchestratorServer).Work(&grpc.GenericServerStream[AgentMessage, TaskAssignment]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Orchestrator_WorkServer = grpc.BidiStreamingServer[AgentMessage, TaskAssignment]
+
 // Orchestrator_ServiceDesc is the grpc.ServiceDesc for Orchestrator service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +215,18 @@ var Orchestrator_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PostTask",
 			Handler:    _Orchestrator_PostTask_Handler,
 		},
+		{
+			MethodName: "FailTask",
+			Handler:    _Orchestrator_FailTask_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Work",
+			Handler:       _Orchestrator_Work_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "orchestrator.proto",
 }
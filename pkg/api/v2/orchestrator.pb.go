@@ -0,0 +1,827 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v3.21.12
+// source: v2/orchestrator.proto
+
+// api.v2 carries arguments and results as double, api.Orchestrator is kept for agents that still use float
+
+package apiv2
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetTaskRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// agent_id identifies the registered agent the task is handed out to, it may be empty for anonymous agents
+	AgentId string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	// operations are the operators and functions the agent can compute, the ones it registered with are used if it is empty
+	Operations []string `protobuf:"bytes,2,rep,name=operations,proto3" json:"operations,omitempty"`
+	// wait makes the orchestrator wait for a task until the deadline of the request instead of returning NotFound at once
+	Wait          bool `protobuf:"varint,3,opt,name=wait,proto3" json:"wait,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTaskRequest) Reset() {
+	*x = GetTaskRequest{}
+	mi := &file_v2_orchestrator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTaskRequest) ProtoMessage() {}
+
+func (x *GetTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTaskRequest.ProtoReflect.Descriptor instead.
+func (*GetTaskRequest) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetTaskRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *GetTaskRequest) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+func (x *GetTaskRequest) GetWait() bool {
+	if x != nil {
+		return x.Wait
+	}
+	return false
+}
+
+type GetTaskResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the id of the expression the task belongs to
+	Id int32 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// task_id identifies the operation within the expression, results are matched to operations by it
+	TaskId string `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	// operation is an operator (+, -, *, /, ^, %, //, ~) or a function name (sqrt, max, ...)
+	Operation     string    `protobuf:"bytes,3,opt,name=operation,proto3" json:"operation,omitempty"`
+	OperationTime int32     `protobuf:"varint,4,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
+	Args          []float64 `protobuf:"fixed64,5,rep,packed,name=args,proto3" json:"args,omitempty"`
+	// mode is "decimal" when the task is computed exactly, the arguments are decimal_args then
+	Mode string `protobuf:"bytes,6,opt,name=mode,proto3" json:"mode,omitempty"`
+	// decimal_args are exact fractions or integers, e.g. "1/3" or "-5"
+	DecimalArgs   []string `protobuf:"bytes,7,rep,name=decimal_args,json=decimalArgs,proto3" json:"decimal_args,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTaskResponse) Reset() {
+	*x = GetTaskResponse{}
+	mi := &file_v2_orchestrator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTaskResponse) ProtoMessage() {}
+
+func (x *GetTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTaskResponse.ProtoReflect.Descriptor instead.
+func (*GetTaskResponse) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetTaskResponse) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetOperationTime() int32 {
+	if x != nil {
+		return x.OperationTime
+	}
+	return 0
+}
+
+func (x *GetTaskResponse) GetArgs() []float64 {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *GetTaskResponse) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *GetTaskResponse) GetDecimalArgs() []string {
+	if x != nil {
+		return x.DecimalArgs
+	}
+	return nil
+}
+
+type PostTaskRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Id     int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TaskId string                 `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	Result float64                `protobuf:"fixed64,3,opt,name=result,proto3" json:"result,omitempty"`
+	// decimal_result is the exact result of the task in the decimal mode, e.g. "1/3"
+	DecimalResult string `protobuf:"bytes,4,opt,name=decimal_result,json=decimalResult,proto3" json:"decimal_result,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostTaskRequest) Reset() {
+	*x = PostTaskRequest{}
+	mi := &file_v2_orchestrator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostTaskRequest) ProtoMessage() {}
+
+func (x *PostTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostTaskRequest.ProtoReflect.Descriptor instead.
+func (*PostTaskRequest) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PostTaskRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PostTaskRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *PostTaskRequest) GetResult() float64 {
+	if x != nil {
+		return x.Result
+	}
+	return 0
+}
+
+func (x *PostTaskRequest) GetDecimalResult() string {
+	if x != nil {
+		return x.DecimalResult
+	}
+	return ""
+}
+
+type PostTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostTaskResponse) Reset() {
+	*x = PostTaskResponse{}
+	mi := &file_v2_orchestrator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostTaskResponse) ProtoMessage() {}
+
+func (x *PostTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostTaskResponse.ProtoReflect.Descriptor instead.
+func (*PostTaskResponse) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{3}
+}
+
+type FailTaskRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Id     int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TaskId string                 `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	// error is the reason the agent could not compute the task, the expression fails with it
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailTaskRequest) Reset() {
+	*x = FailTaskRequest{}
+	mi := &file_v2_orchestrator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailTaskRequest) ProtoMessage() {}
+
+func (x *FailTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailTaskRequest.ProtoReflect.Descriptor instead.
+func (*FailTaskRequest) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FailTaskRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *FailTaskRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *FailTaskRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type FailTaskResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailTaskResponse) Reset() {
+	*x = FailTaskResponse{}
+	mi := &file_v2_orchestrator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailTaskResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailTaskResponse) ProtoMessage() {}
+
+func (x *FailTaskResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailTaskResponse.ProtoReflect.Descriptor instead.
+func (*FailTaskResponse) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{5}
+}
+
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// credits is the number of tasks the agent is ready to take in addition to the ones already sent to it
+	Credits int32            `protobuf:"varint,1,opt,name=credits,proto3" json:"credits,omitempty"`
+	Result  *PostTaskRequest `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	Failure *FailTaskRequest `protobuf:"bytes,3,opt,name=failure,proto3" json:"failure,omitempty"`
+	// agent_id identifies the registered agent, it is sent in the first message of the stream
+	AgentId       string `protobuf:"bytes,4,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_v2_orchestrator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AgentMessage) GetCredits() int32 {
+	if x != nil {
+		return x.Credits
+	}
+	return 0
+}
+
+func (x *AgentMessage) GetResult() *PostTaskRequest {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetFailure() *FailTaskRequest {
+	if x != nil {
+		return x.Failure
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+type TaskAssignment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Task          *GetTaskResponse       `protobuf:"bytes,1,opt,name=task,proto3" json:"task,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskAssignment) Reset() {
+	*x = TaskAssignment{}
+	mi := &file_v2_orchestrator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskAssignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskAssignment) ProtoMessage() {}
+
+func (x *TaskAssignment) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskAssignment.ProtoReflect.Descriptor instead.
+func (*TaskAssignment) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TaskAssignment) GetTask() *GetTaskResponse {
+	if x != nil {
+		return x.Task
+	}
+	return nil
+}
+
+type RegisterAgentRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	AgentId  string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Hostname string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	// computing_power is the number of tasks the agent computes at the same time
+	ComputingPower int32 `protobuf:"varint,3,opt,name=computing_power,json=computingPower,proto3" json:"computing_power,omitempty"`
+	// operations are the operators and functions the agent can compute
+	Operations    []string `protobuf:"bytes,4,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterAgentRequest) Reset() {
+	*x = RegisterAgentRequest{}
+	mi := &file_v2_orchestrator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterAgentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterAgentRequest) ProtoMessage() {}
+
+func (x *RegisterAgentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterAgentRequest.ProtoReflect.Descriptor instead.
+func (*RegisterAgentRequest) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RegisterAgentRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterAgentRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *RegisterAgentRequest) GetComputingPower() int32 {
+	if x != nil {
+		return x.ComputingPower
+	}
+	return 0
+}
+
+func (x *RegisterAgentRequest) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type RegisterAgentResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// heartbeat_interval_ms is how often the agent must send heartbeats to stay registered
+	HeartbeatIntervalMs int32 `protobuf:"varint,1,opt,name=heartbeat_interval_ms,json=heartbeatIntervalMs,proto3" json:"heartbeat_interval_ms,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RegisterAgentResponse) Reset() {
+	*x = RegisterAgentResponse{}
+	mi := &file_v2_orchestrator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterAgentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterAgentResponse) ProtoMessage() {}
+
+func (x *RegisterAgentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterAgentResponse.ProtoReflect.Descriptor instead.
+func (*RegisterAgentResponse) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RegisterAgentResponse) GetHeartbeatIntervalMs() int32 {
+	if x != nil {
+		return x.HeartbeatIntervalMs
+	}
+	return 0
+}
+
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_v2_orchestrator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *HeartbeatRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+// HeartbeatResponse is empty, NotFound is returned to agents that are not registered, they have to register again
+type HeartbeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_v2_orchestrator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_orchestrator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_v2_orchestrator_proto_rawDescGZIP(), []int{11}
+}
+
+var File_v2_orchestrator_proto protoreflect.FileDescriptor
+
+const file_v2_orchestrator_proto_rawDesc = "" +
+	"\n" +
+	"\x15v2/orchestrator.proto\x12\x06api.v2\"_\n" +
+	"\x0eGetTaskRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x02 \x03(\tR\n" +
+	"operations\x12\x12\n" +
+	"\x04wait\x18\x03 \x01(\bR\x04wait\"\xca\x01\n" +
+	"\x0fGetTaskResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x1c\n" +
+	"\toperation\x18\x03 \x01(\tR\toperation\x12%\n" +
+	"\x0eoperation_time\x18\x04 \x01(\x05R\roperationTime\x12\x12\n" +
+	"\x04args\x18\x05 \x03(\x01R\x04args\x12\x12\n" +
+	"\x04mode\x18\x06 \x01(\tR\x04mode\x12!\n" +
+	"\fdecimal_args\x18\a \x03(\tR\vdecimalArgs\"y\n" +
+	"\x0fPostTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x16\n" +
+	"\x06result\x18\x03 \x01(\x01R\x06result\x12%\n" +
+	"\x0edecimal_result\x18\x04 \x01(\tR\rdecimalResult\"\x12\n" +
+	"\x10PostTaskResponse\"P\n" +
+	"\x0fFailTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x12\n" +
+	"\x10FailTaskResponse\"\xa7\x01\n" +
+	"\fAgentMessage\x12\x18\n" +
+	"\acredits\x18\x01 \x01(\x05R\acredits\x12/\n" +
+	"\x06result\x18\x02 \x01(\v2\x17.api.v2.PostTaskRequestR\x06result\x121\n" +
+	"\afailure\x18\x03 \x01(\v2\x17.api.v2.FailTaskRequestR\afailure\x12\x19\n" +
+	"\bagent_id\x18\x04 \x01(\tR\aagentId\"=\n" +
+	"\x0eTaskAssignment\x12+\n" +
+	"\x04task\x18\x01 \x01(\v2\x17.api.v2.GetTaskResponseR\x04task\"\x96\x01\n" +
+	"\x14RegisterAgentRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12'\n" +
+	"\x0fcomputing_power\x18\x03 \x01(\x05R\x0ecomputingPower\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x04 \x03(\tR\n" +
+	"operations\"K\n" +
+	"\x15RegisterAgentResponse\x122\n" +
+	"\x15heartbeat_interval_ms\x18\x01 \x01(\x05R\x13heartbeatIntervalMs\"-\n" +
+	"\x10HeartbeatRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"\x13\n" +
+	"\x11HeartbeatResponse2\x92\x03\n" +
+	"\fOrchestrator\x12:\n" +
+	"\aGetTask\x12\x16.api.v2.GetTaskRequest\x1a\x17.api.v2.GetTaskResponse\x12=\n" +
+	"\bPostTask\x12\x17.api.v2.PostTaskRequest\x1a\x18.api.v2.PostTaskResponse\x12=\n" +
+	"\bFailTask\x12\x17.api.v2.FailTaskRequest\x1a\x18.api.v2.FailTaskResponse\x128\n" +
+	"\x04Work\x12\x14.api.v2.AgentMessage\x1a\x16.api.v2.TaskAssignment(\x010\x01\x12L\n" +
+	"\rRegisterAgent\x12\x1c.api.v2.RegisterAgentRequest\x1a\x1d.api.v2.RegisterAgentResponse\x12@\n" +
+	"\tHeartbeat\x12\x18.api.v2.HeartbeatRequest\x1a\x19.api.v2.HeartbeatResponseB\x12Z\x10pkg/api/v2;apiv2b\x06proto3"
+
+var (
+	file_v2_orchestrator_proto_rawDescOnce sync.Once
+	file_v2_orchestrator_proto_rawDescData []byte
+)
+
+func file_v2_orchestrator_proto_rawDescGZIP() []byte {
+	file_v2_orchestrator_proto_rawDescOnce.Do(func() {
+		file_v2_orchestrator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_orchestrator_proto_rawDesc), len(file_v2_orchestrator_proto_rawDesc)))
+	})
+	return file_v2_orchestrator_proto_rawDescData
+}
+
+var file_v2_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_v2_orchestrator_proto_goTypes = []any{
+	(*GetTaskRequest)(nil),        // 0: api.v2.GetTaskRequest
+	(*GetTaskResponse)(nil),       // 1: api.v2.GetTaskResponse
+	(*PostTaskRequest)(nil),       // 2: api.v2.PostTaskRequest
+	(*PostTaskResponse)(nil),      // 3: api.v2.PostTaskResponse
+	(*FailTaskRequest)(nil),       // 4: api.v2.FailTaskRequest
+	(*FailTaskResponse)(nil),      // 5: api.v2.FailTaskResponse
+	(*AgentMessage)(nil),          // 6: api.v2.AgentMessage
+	(*TaskAssignment)(nil),        // 7: api.v2.TaskAssignment
+	(*RegisterAgentRequest)(nil),  // 8: api.v2.RegisterAgentRequest
+	(*RegisterAgentResponse)(nil), // 9: api.v2.RegisterAgentResponse
+	(*HeartbeatRequest)(nil),      // 10: api.v2.HeartbeatRequest
+	(*HeartbeatResponse)(nil),     // 11: api.v2.HeartbeatResponse
+}
+var file_v2_orchestrator_proto_depIdxs = []int32{
+	2,  // 0: api.v2.AgentMessage.result:type_name -> api.v2.PostTaskRequest
+	4,  // 1: api.v2.AgentMessage.failure:type_name -> api.v2.FailTaskRequest
+	1,  // 2: api.v2.TaskAssignment.task:type_name -> api.v2.GetTaskResponse
+	0,  // 3: api.v2.Orchestrator.GetTask:input_type -> api.v2.GetTaskRequest
+	2,  // 4: api.v2.Orchestrator.PostTask:input_type -> api.v2.PostTaskRequest
+	4,  // 5: api.v2.Orchestrator.FailTask:input_type -> api.v2.FailTaskRequest
+	6,  // 6: api.v2.Orchestrator.Work:input_type -> api.v2.AgentMessage
+	8,  // 7: api.v2.Orchestrator.RegisterAgent:input_type -> api.v2.RegisterAgentRequest
+	10, // 8: api.v2.Orchestrator.Heartbeat:input_type -> api.v2.HeartbeatRequest
+	1,  // 9: api.v2.Orchestrator.GetTask:output_type -> api.v2.GetTaskResponse
+	3,  // 10: api.v2.Orchestrator.PostTask:output_type -> api.v2.PostTaskResponse
+	5,  // 11: api.v2.Orchestrator.FailTask:output_type -> api.v2.FailTaskResponse
+	7,  // 12: api.v2.Orchestrator.Work:output_type -> api.v2.TaskAssignment
+	9,  // 13: api.v2.Orchestrator.RegisterAgent:output_type -> api.v2.RegisterAgentResponse
+	11, // 14: api.v2.Orchestrator.Heartbeat:output_type -> api.v2.HeartbeatResponse
+	9,  // [9:15] is the sub-list for method output_type
+	3,  // [3:9] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_v2_orchestrator_proto_init() }
+func file_v2_orchestrator_proto_init() {
+	if File_v2_orchestrator_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_orchestrator_proto_rawDesc), len(file_v2_orchestrator_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_v2_orchestrator_proto_goTypes,
+		DependencyIndexes: file_v2_orchestrator_proto_depIdxs,
+		MessageInfos:      file_v2_orchestrator_proto_msgTypes,
+	}.Build()
+	File_v2_orchestrator_proto = out.File
+	file_v2_orchestrator_proto_goTypes = nil
+	file_v2_orchestrator_proto_depIdxs = nil
+}
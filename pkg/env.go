@@ -0,0 +1,19 @@
+package pkg
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetEnvAsInt returns the value of the environment variable as an integer
+func GetEnvAsInt(name string, defaultValue int) int {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
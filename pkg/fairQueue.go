@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+)
+
+// Fair is implemented by elements of FairQueue, other elements share one sub-queue with priority 0
+type Fair interface {
+	// QueueKey is the key of the sub-queue of the element, sub-queues take turns
+	QueueKey() string
+	// QueuePriority orders the elements of one sub-queue, higher first
+	QueuePriority() int
+}
+
+type fairEntry struct {
+	element  interface{}
+	priority int
+}
+
+// FairQueue is a set of priority sub-queues that are dequeued in turn, so the elements
+// of one key can't starve the others. Elements of the same priority in a sub-queue are dequeued in order
+type FairQueue struct {
+	queues map[string][]fairEntry
+	// keys are the keys of non-empty sub-queues in the order they take turns
+	keys []string
+	// next is the position in keys of the sub-queue that dequeues next
+	next    int
+	size    int
+	mutex   sync.Mutex
+	waiters waiters
+}
+
+func NewFairQueue() *FairQueue {
+	return &FairQueue{queues: make(map[string][]fairEntry)}
+}
+
+func (fq *FairQueue) Enqueue(element interface{}) {
+	key, priority := "", 0
+	if fair, ok := element.(Fair); ok {
+		key, priority = fair.QueueKey(), fair.QueuePriority()
+	}
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+	queue, ok := fq.queues[key]
+	if !ok {
+		fq.keys = append(fq.keys, key)
+	}
+	// the entry is put after the entries of the same or higher priority
+	i := len(queue)
+	for i > 0 && queue[i-1].priority < priority {
+		i--
+	}
+	queue = append(queue, fairEntry{})
+	copy(queue[i+1:], queue[i:])
+	queue[i] = fairEntry{element: element, priority: priority}
+	fq.queues[key] = queue
+	fq.size++
+	fq.waiters.wake()
+}
+
+func (fq *FairQueue) Dequeue() interface{} {
+	return fq.DequeueFunc(nil)
+}
+
+// DequeueFunc dequeues the first element satisfying match from the next sub-queue that has one,
+// nil is returned if there is none. A nil match accepts any element
+func (fq *FairQueue) DequeueFunc(match func(interface{}) bool) interface{} {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	element, _ := fq.take(match)
+	return element
+}
+
+// DequeueWait waits until the queue is not empty and dequeues the element like Queue.DequeueWait
+func (fq *FairQueue) DequeueWait(ctx context.Context) (interface{}, error) {
+	return fq.DequeueWaitFunc(ctx, nil)
+}
+
+// DequeueWaitFunc waits like Queue.DequeueWaitFunc, the element is dequeued in turn like by DequeueFunc
+func (fq *FairQueue) DequeueWaitFunc(ctx context.Context, match func(interface{}) bool) (interface{}, error) {
+	return fq.waiters.wait(ctx, &fq.mutex, func() (interface{}, bool) { return fq.take(match) })
+}
+
+// take removes the element and passes the turn to the sub-queue after its one, the caller must hold the mutex
+func (fq *FairQueue) take(match func(interface{}) bool) (interface{}, bool) {
+	for n := 0; n < len(fq.keys); n++ {
+		k := (fq.next + n) % len(fq.keys)
+		key := fq.keys[k]
+		queue := fq.queues[key]
+		for i, entry := range queue {
+			if match != nil && !match(entry.element) {
+				continue
+			}
+			fq.size--
+			if len(queue) == 1 {
+				delete(fq.queues, key)
+				fq.keys = append(fq.keys[:k:k], fq.keys[k+1:]...)
+				fq.next = k
+			} else {
+				fq.queues[key] = append(queue[:i:i], queue[i+1:]...)
+				fq.next = k + 1
+			}
+			if fq.next >= len(fq.keys) {
+				fq.next = 0
+			}
+			return entry.element, true
+		}
+	}
+	return nil, false
+}
+
+func (fq *FairQueue) IsEmpty() bool {
+	return fq.Len() == 0
+}
+
+func (fq *FairQueue) Len() int {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	return fq.size
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+)
+
+type lease struct {
+	element  interface{}
+	deadline time.Time
+}
+
+// Leases tracks elements handed out until they are released or their deadline passes
+type Leases struct {
+	leases map[string]lease
+	mutex  sync.Mutex
+}
+
+func NewLeases() *Leases {
+	return &Leases{leases: make(map[string]lease)}
+}
+
+// Acquire stores the element by the key until the deadline
+func (l *Leases) Acquire(key string, element interface{}, deadline time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.leases[key] = lease{element: element, deadline: deadline}
+}
+
+// Get returns the element leased by the key, nil is returned if the key is absent
+func (l *Leases) Get(key string) interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.leases[key].element
+}
+
+// Release removes the lease and returns its element, nil is returned if the key is absent
+func (l *Leases) Release(key string) interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current, ok := l.leases[key]
+	if !ok {
+		return nil
+	}
+	delete(l.leases, key)
+	return current.element
+}
+
+// Expire removes the leases whose deadline is before now and returns their elements
+func (l *Leases) Expire(now time.Time) []interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var expired []interface{}
+	for key, current := range l.leases {
+		if current.deadline.Before(now) {
+			expired = append(expired, current.element)
+			delete(l.leases, key)
+		}
+	}
+	return expired
+}
+
+func (l *Leases) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.leases)
+}
@@ -29,8 +29,22 @@ func (s *SafeMap) Delete(key string) {
 	delete(s.m, key)
 }
 
+// GetAll returns a copy of the map, so it can be iterated while the map is changed
 func (s *SafeMap) GetAll() map[string]interface{} {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	return s.m
+	all := make(map[string]interface{}, len(s.m))
+	for key, value := range s.m {
+		all[key] = value
+	}
+	return all
+}
+
+// Pop returns the value stored by the key and deletes it, nil is returned if the key is absent
+func (s *SafeMap) Pop(key string) interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	value := s.m[key]
+	delete(s.m, key)
+	return value
 }
@@ -0,0 +1,58 @@
+package pkg
+
+import "sync"
+
+// subscriberBuffer is the number of messages a subscriber may lag behind the publisher
+const subscriberBuffer = 16
+
+// PubSub delivers messages published by a key to the subscribers of the key
+type PubSub struct {
+	subscribers map[string]map[chan interface{}]struct{}
+	mutex       sync.Mutex
+}
+
+func NewPubSub() *PubSub {
+	return &PubSub{subscribers: make(map[string]map[chan interface{}]struct{})}
+}
+
+// Subscribe returns the channel of the messages published by the key and the function that unsubscribes.
+// The channel is closed if the subscriber lags behind, so publishers are never blocked
+func (ps *PubSub) Subscribe(key string) (<-chan interface{}, func()) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ch := make(chan interface{}, subscriberBuffer)
+	if ps.subscribers[key] == nil {
+		ps.subscribers[key] = make(map[chan interface{}]struct{})
+	}
+	ps.subscribers[key][ch] = struct{}{}
+	return ch, func() {
+		ps.mutex.Lock()
+		defer ps.mutex.Unlock()
+		ps.remove(key, ch)
+	}
+}
+
+// Publish sends the message to the subscribers of the key
+func (ps *PubSub) Publish(key string, message interface{}) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	for ch := range ps.subscribers[key] {
+		select {
+		case ch <- message:
+		default:
+			ps.remove(key, ch)
+		}
+	}
+}
+
+// remove closes the channel of the subscriber if it is still subscribed, the caller must hold the mutex
+func (ps *PubSub) remove(key string, ch chan interface{}) {
+	if _, ok := ps.subscribers[key][ch]; !ok {
+		return
+	}
+	delete(ps.subscribers[key], ch)
+	close(ch)
+	if len(ps.subscribers[key]) == 0 {
+		delete(ps.subscribers, key)
+	}
+}
@@ -1,15 +1,20 @@
 package pkg
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type Queue struct {
-	queue []interface{}
-	mutex sync.Mutex
+	queue   []interface{}
+	mutex   sync.Mutex
+	waiters waiters
 }
 
 func (cq *Queue) Enqueue(element interface{}) {
 	cq.mutex.Lock()
 	cq.queue = append(cq.queue, element)
+	cq.waiters.wake()
 	cq.mutex.Unlock()
 }
 
@@ -26,6 +31,37 @@ func (cq *Queue) Dequeue() interface{} {
 	return element
 }
 
+// DequeueFunc dequeues the first element satisfying match and keeps the others in order, nil is returned if there is none
+func (cq *Queue) DequeueFunc(match func(interface{}) bool) interface{} {
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	element, _ := cq.take(match)
+	return element
+}
+
+// DequeueWait waits until the queue is not empty and dequeues the element, an error is returned if the context is done first
+func (cq *Queue) DequeueWait(ctx context.Context) (interface{}, error) {
+	return cq.DequeueWaitFunc(ctx, nil)
+}
+
+// DequeueWaitFunc waits until an element satisfying match is enqueued and dequeues it,
+// an error is returned if the context is done first. A nil match accepts any element
+func (cq *Queue) DequeueWaitFunc(ctx context.Context, match func(interface{}) bool) (interface{}, error) {
+	return cq.waiters.wait(ctx, &cq.mutex, func() (interface{}, bool) { return cq.take(match) })
+}
+
+// take removes the first element satisfying match, the caller must hold the mutex
+func (cq *Queue) take(match func(interface{}) bool) (interface{}, bool) {
+	for i, element := range cq.queue {
+		if match == nil || match(element) {
+			cq.queue = append(cq.queue[:i:i], cq.queue[i+1:]...)
+			return element, true
+		}
+	}
+	return nil, false
+}
+
 func (cq *Queue) Peek() interface{} {
 	cq.mutex.Lock()
 	defer cq.mutex.Unlock()
@@ -43,3 +79,11 @@ func (cq *Queue) IsEmpty() bool {
 
 	return len(cq.queue) == 0
 }
+
+// Len returns the number of elements in the queue
+func (cq *Queue) Len() int {
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	return len(cq.queue)
+}
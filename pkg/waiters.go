@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+)
+
+// waiters are the consumers waiting for an element of a queue, they are guarded by the mutex of the queue
+type waiters struct {
+	// ready is closed when an element is enqueued to wake up the waiting consumers
+	ready chan struct{}
+}
+
+// wake wakes up the waiting consumers, the caller must hold the mutex of the queue
+func (w *waiters) wake() {
+	if w.ready != nil {
+		close(w.ready)
+		w.ready = nil
+	}
+}
+
+// wait calls take under the mutex until it returns an element and waits for the next wake between the calls,
+// an error is returned if the context is done first
+func (w *waiters) wait(ctx context.Context, mutex *sync.Mutex, take func() (interface{}, bool)) (interface{}, error) {
+	for {
+		mutex.Lock()
+		if element, ok := take(); ok {
+			mutex.Unlock()
+			return element, nil
+		}
+		if w.ready == nil {
+			w.ready = make(chan struct{})
+		}
+		ready := w.ready
+		mutex.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}